@@ -7,17 +7,19 @@ import (
 )
 
 const (
-	Glyph_hbar      = '─'
-	Glyph_vbar      = '│'
-	Glyph_corner_tl = '┌'
-	Glyph_corner_tr = '┐'
-	Glyph_corner_bl = '└'
-	Glyph_corner_br = '┘'
-	Glyph_plus      = '┼'
-	Glyph_T         = '┬'
-	Glyph_pin       = '┴'
-	Glyph_lstile    = '├'
-	Glyph_rstile    = '┤'
+	Glyph_hbar       = '─'
+	Glyph_vbar       = '│'
+	Glyph_corner_tl  = '┌'
+	Glyph_corner_tr  = '┐'
+	Glyph_corner_bl  = '└'
+	Glyph_corner_br  = '┘'
+	Glyph_plus       = '┼'
+	Glyph_T          = '┬'
+	Glyph_pin        = '┴'
+	Glyph_lstile     = '├'
+	Glyph_rstile     = '┤'
+	Glyph_more_left  = '«'
+	Glyph_more_right = '»'
 )
 
 type ScrollInfo struct {
@@ -0,0 +1,223 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// A command may be given the lines it acts on by an address in front
+// of it, as in ed:
+//
+//	.        the cursor line
+//	$        the last line
+//	10       line 10
+//	'a       the named range a: its first line at the start of a
+//	         range, its last line at the end, and all of it alone
+//	/re/     the next line matching the regular expression re, after
+//	         the cursor line, or after the first line of a range
+//	?re?     the previous line matching it
+//	+3, -2   lines after or before the cursor line, or after or
+//	         before the address they follow
+//
+// Two addresses separated by a comma give the lines between them, and
+// a comma or % alone gives every line. A /re/ or ?re? at the start of
+// a line is only an address when followed by a blank, a comma, + or -;
+// otherwise the line is a search.
+//
+// The addressed lines stand in for the main marked range while the
+// command runs, so commands that act on the marked range act on them;
+// d, s, w and r, which otherwise act on the cursor line or the whole
+// buffer, act on them too. The marked range is as it was afterwards.
+// An address with no command moves the cursor to the first addressed
+// line.
+
+// runAddressed runs line, which starts with an address, on the lines
+// it addresses.
+func (ep *EditorPanel) runAddressed(first, last int, rest string) error {
+	rest = strings.TrimLeft(rest, " \t")
+	if rest == "" {
+		ep.main.Where.Line = first
+		return nil
+	}
+	marked, addressed := ep.main.Marked, text.NewMarkedRange(ep.main.Buffer)
+	addressed.SetRange(first, last)
+	ep.main.Marked, ep.addressed = addressed, true
+	defer func() {
+		ep.addressed = false
+		if ep.main.Marked != addressed {
+			// the command replaced the marked range, as xr and e do
+			marked.Clear()
+			return
+		}
+		addressed.Clear()
+		ep.main.Marked = marked
+	}()
+	return runLine(ep, rest)
+}
+
+// address reads the address at the start of line, if there is one,
+// returning the lines it gives, counting from 0, and the rest of the
+// line. found is false if line does not start with an address.
+func (ep *EditorPanel) address(line string) (first, last int, rest string, found bool, err error) {
+	if !startsAddress(line) {
+		return 0, 0, line, false, nil
+	}
+	b := ep.main.Buffer
+	if b.LineCount() == 0 {
+		return 0, 0, "", true, errors.New("no lines to address")
+	}
+	if line[0] == '%' || line[0] == ',' && !startsAddress(line[1:]) {
+		return 0, b.LineCount() - 1, line[1:], true, nil
+	}
+	first, last, rest, err = ep.lineAddress(line, 0, ep.main.Where.Line)
+	if err != nil {
+		return 0, 0, "", true, err
+	}
+	if strings.HasPrefix(rest, ",") {
+		if rest == "," {
+			return 0, 0, "", true, errors.New("expected an address after ,")
+		}
+		_, last, rest, err = ep.lineAddress(rest[1:], 1, first)
+		if err != nil {
+			return 0, 0, "", true, err
+		}
+	}
+	if last < first {
+		return 0, 0, "", true, errors.New("addresses out of order")
+	}
+	return first, last, rest, true, nil
+}
+
+// startsAddress reports whether line starts with an address.
+func startsAddress(line string) bool {
+	if line == "" {
+		return false
+	}
+	switch ch := line[0]; {
+	case strings.IndexByte(".$'+-%,", ch) >= 0 || '0' <= ch && ch <= '9':
+		return true
+	case ch == '/' || ch == '?':
+		end := closingDelimiter(line[1:], ch)
+		return end >= 0 && end+2 < len(line) && strings.IndexByte(" \t,+-", line[end+2]) >= 0
+	}
+	return false
+}
+
+// closingDelimiter returns the index in s of the first delim not
+// escaped by a backslash, or -1.
+func closingDelimiter(s string, delim byte) int {
+	for i := 0; i < len(s); i += 1 {
+		switch s[i] {
+		case '\\':
+			i += 1
+		case delim:
+			return i
+		}
+	}
+	return -1
+}
+
+// lineAddress reads one address from the start of s, followed by any
+// offsets. A named range gives both its lines; otherwise first and
+// last are the same. end is 0 for the start of a range and 1 for its
+// end, which decides the line that a named range gives when there are
+// two addresses. A pattern is looked for from the line from.
+func (ep *EditorPanel) lineAddress(s string, end, from int) (first, last int, rest string, err error) {
+	b := ep.main.Buffer
+	line := ep.main.Where.Line
+	first, last = -1, -1
+	switch ch := s[0]; {
+	case ch == '.':
+		first, s = line, s[1:]
+	case ch == '$':
+		first, s = b.LineCount()-1, s[1:]
+	case '0' <= ch && ch <= '9':
+		i := 0
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i += 1
+		}
+		n, _ := strconv.Atoi(s[:i])
+		first, s = n-1, s[i:]
+	case ch == '\'':
+		if len(s) < 2 {
+			return 0, 0, "", errors.New("expected a name a-z after '")
+		}
+		named := namedRanges[rune(s[1])]
+		if named == nil || !named.IsActive() {
+			return 0, 0, "", fmt.Errorf("no range %c", s[1])
+		}
+		if named.Buffer() != b {
+			return 0, 0, "", fmt.Errorf("range %c is in another buffer", s[1])
+		}
+		first, last = named.Range()
+		s = s[2:]
+	case ch == '/' || ch == '?':
+		stop := closingDelimiter(s[1:], ch)
+		if stop < 0 {
+			return 0, 0, "", fmt.Errorf("missing closing %c", ch)
+		}
+		pattern, _ := splitDelimited(s[1:], ch)
+		if first, err = ep.matchingLine(pattern, from, ch == '?'); err != nil {
+			return 0, 0, "", err
+		}
+		s = s[stop+2:]
+	case ch == '+' || ch == '-':
+		first = line
+	default:
+		return 0, 0, "", fmt.Errorf("not an address: %v", s)
+	}
+	if last < 0 {
+		last = first
+	}
+	for len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		i := 1
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i += 1
+		}
+		n := 1
+		if i > 1 {
+			n, _ = strconv.Atoi(s[1:i])
+		}
+		if s[0] == '-' {
+			n = -n
+		}
+		first, last, s = first+n, last+n, s[i:]
+	}
+	for _, l := range []int{first, last} {
+		if l < 0 || l >= b.LineCount() {
+			return 0, 0, "", fmt.Errorf("no line %v", l+1)
+		}
+	}
+	if end == 1 {
+		first = last
+	}
+	return first, last, s, nil
+}
+
+// matchingLine returns the next line after line, or before it if
+// backward, that matches the regular expression pattern, wrapping
+// around the buffer.
+func (ep *EditorPanel) matchingLine(pattern string, line int, backward bool) (int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, err
+	}
+	b := ep.main.Buffer
+	count := b.LineCount()
+	step := 1
+	if backward {
+		step = count - 1
+	}
+	for i := 0; i < count; i += 1 {
+		line = (line + step) % count
+		if re.MatchString(b.Line(line)) {
+			return line, nil
+		}
+	}
+	return 0, errors.New("no line matches " + pattern)
+}
@@ -0,0 +1,243 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// buffers are the open buffers, in the order they were opened, each
+// wrapped in its undo journal. Any panel may show any of them.
+var buffers []*text.Journal
+
+// register adds b to the open buffers.
+func register(b text.Buffer) *text.Journal {
+	j := text.NewJournal(b)
+	buffers = append(buffers, j)
+	return j
+}
+
+// bufferName is how b is shown in the buffer list.
+func bufferName(b text.Buffer) string {
+	if b.FileName() == "" {
+		return "(no name)"
+	}
+	return b.FileName()
+}
+
+// sameFile reports whether two file names name the same file.
+func sameFile(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// openBuffer returns the open buffer for the named file, opening it
+// if need be.
+func openBuffer(fileName string) (*text.Journal, error) {
+	for _, j := range buffers {
+		if j.FileName() != "" && sameFile(j.FileName(), fileName) {
+			return j, nil
+		}
+	}
+	b, err := openFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return register(b), nil
+}
+
+// findBuffer returns the open buffer named by s: its number in the
+// buffer list, its file name, or the last element of its file name if
+// only one buffer has it.
+func findBuffer(s string) (*text.Journal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > len(buffers) {
+			return nil, fmt.Errorf("no buffer %v", n)
+		}
+		return buffers[n-1], nil
+	}
+	var found []*text.Journal
+	for _, j := range buffers {
+		if name := j.FileName(); name != "" && (sameFile(name, s) || filepath.Base(name) == s) {
+			found = append(found, j)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, errors.New("no buffer " + s)
+	case 1:
+		return found[0], nil
+	}
+	return nil, errors.New("more than one buffer " + s)
+}
+
+// show makes j the main buffer of ep, with the cursor where it was
+// when ep last showed j, or at its start. The buffer shown before
+// keeps no anchors for ep; if it was an empty buffer with no name that
+// no panel now shows, it is closed.
+func (ep *EditorPanel) show(j *text.Journal) {
+	old, _ := ep.main.Buffer.(*text.Journal)
+	if old != nil {
+		if ep.listing == nil && ep.choices == nil {
+			if ep.places == nil {
+				ep.places = map[*text.Journal]grid.LineCol{}
+			}
+			ep.places[old] = ep.main.Where.LineCol
+		}
+		ep.main.Where.Release()
+		ep.main.Marked.Clear()
+	}
+	ep.main = NewState(j)
+	ep.main.Where.LineCol = within(j, ep.places[j])
+	ep.current = &ep.main
+	ep.listing = nil
+	ep.choices = nil
+	if old != nil && old != j {
+		closeIfUnused(old)
+	}
+}
+
+// within returns where, moved to the start of the line after the last
+// of b if it is beyond that.
+func within(b text.Buffer, where grid.LineCol) grid.LineCol {
+	if n := b.LineCount(); where.Line > n {
+		return grid.LineCol{Line: n}
+	}
+	return where
+}
+
+// closeIfUnused closes j if it is an empty, unchanged buffer with no
+// file name, such as a new panel starts with, that no panel shows.
+func closeIfUnused(j *text.Journal) {
+	if j.FileName() != "" || j.LineCount() > 0 || j.Modified() {
+		return
+	}
+	for _, p := range panels {
+		if p.main.Buffer == j {
+			return
+		}
+	}
+	forget(j)
+}
+
+// forget removes j from the open buffers and from the places panels
+// keep for it, and lists the buffers afresh in panels that list them.
+func forget(j *text.Journal) {
+	for i, b := range buffers {
+		if b == j {
+			buffers = append(buffers[:i], buffers[i+1:]...)
+			break
+		}
+	}
+	for _, p := range panels {
+		delete(p.places, j)
+		if p.choices != nil {
+			where := p.main.Where.LineCol
+			listBuffers(p, nil)
+			p.main.Where.LineCol = within(p.main.Buffer, where)
+		}
+	}
+}
+
+// editFile runs "e [file]", which shows the named file in the panel,
+// opening it in a buffer of its own unless it is already open. With no
+// name it shows a new empty buffer.
+func editFile(ep *EditorPanel, blobs []string) error {
+	if len(blobs) < 2 {
+		ep.show(register(newMainBuffer()))
+		return nil
+	}
+	fileName, where := FileArgument(blobs[1])
+	j, err := openBuffer(fileName)
+	if err != nil {
+		return err
+	}
+	ep.show(j)
+	ep.main.Where.LineCol = where
+	return nil
+}
+
+// switchBuffer runs "b name", which shows an open buffer in the panel.
+func switchBuffer(ep *EditorPanel, blobs []string) error {
+	j, err := findBuffer(blobs[1])
+	if err != nil {
+		return err
+	}
+	ep.show(j)
+	return nil
+}
+
+// closeBuffer runs "bd [name]", which closes the named buffer or the
+// one the panel shows. It refuses if the buffer has unsaved changes,
+// which "bd!" discards. Panels showing the buffer show another.
+func closeBuffer(ep *EditorPanel, blobs []string) error {
+	var j *text.Journal
+	if len(blobs) > 1 {
+		var err error
+		if j, err = findBuffer(blobs[1]); err != nil {
+			return err
+		}
+	} else if ep.listing != nil || ep.choices != nil {
+		return errors.New("not a buffer")
+	} else {
+		j = ep.journal()
+	}
+	if j.Modified() && blobs[0] != "bd!" {
+		return fmt.Errorf("unsaved changes in %v; bd! discards them", bufferName(j))
+	}
+	forget(j)
+	for _, p := range panels {
+		if p.main.Buffer == j {
+			if len(buffers) == 0 {
+				register(newMainBuffer())
+			}
+			p.show(buffers[len(buffers)-1])
+		}
+	}
+	return nil
+}
+
+// listBuffers runs "bl", which shows the open buffers in the panel,
+// one a line, numbered for "b". Enter on a line shows that buffer.
+func listBuffers(ep *EditorPanel, blobs []string) error {
+	b := text.NewBuffer(func(b text.Buffer, s string) error { return nil }, text.WithRope())
+	ep.show(text.NewJournal(readOnly{b}))
+	lines := []string{}
+	for i, j := range buffers {
+		modified := " "
+		if j.Modified() {
+			modified = "*"
+		}
+		lines = append(lines, fmt.Sprintf("%3v %v %v  (%v lines)", i+1, modified, bufferName(j), j.LineCount()))
+	}
+	b.ReplaceLines(0, 0, lines)
+	ep.choices = append([]*text.Journal(nil), buffers...)
+	return nil
+}
+
+// chooseBuffer shows the buffer on the cursor line of the buffer list.
+func (ep *EditorPanel) chooseBuffer() {
+	line := ep.main.Where.Line
+	if line < 0 || line >= len(ep.choices) {
+		ep.status = "not a buffer"
+		return
+	}
+	ep.show(ep.choices[line])
+}
+
+// unsavedBuffers returns the open buffers that have changed since they
+// were read or written.
+func unsavedBuffers() []*text.Journal {
+	result := []*text.Journal{}
+	for _, j := range buffers {
+		if j.Modified() {
+			result = append(result, j)
+		}
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// usages give the arguments each word command takes, as its usage
+// line: an argument in brackets may be left out and one ending in ...
+// may be repeated. A command given too few or too many arguments is
+// refused with its usage.
+var usages = map[string]string{
+	"r":        "r file",
+	"ri":       "ri file",
+	"mr":       "mr [line]",
+	"w":        "w [file]",
+	"w!":       "w! [file]",
+	"wr":       "wr file",
+	"ar":       "ar file",
+	"d":        "d",
+	"dr":       "dr [register]",
+	"cr":       "cr register",
+	"p":        "p register",
+	"sr":       "sr name",
+	"xr":       "xr name",
+	"lr":       "lr",
+	"tabs":     "tabs [width|expand|insert|retab|keep...]",
+	"q":        "q",
+	"q!":       "q!",
+	"wq":       "wq",
+	"reload":   "reload",
+	"diff":     "diff [register]",
+	"watch":    "watch on|off",
+	"e":        "e [file]",
+	"b":        "b buffer",
+	"bd":       "bd [buffer]",
+	"bd!":      "bd! [buffer]",
+	"bl":       "bl",
+	"session":  "session [file]",
+	"config":   "config [file]",
+	"describe": "describe [key...]",
+	"search":   "search pattern [flags]",
+	"mark":     "mark [first [last]]",
+	"backup":   "backup none|bak|numbered",
+	"u":        "u",
+	"redo":     "redo",
+}
+
+// arity returns how many arguments a usage line allows, max being -1
+// if there is no limit.
+func arity(usage string) (min, max int) {
+	for _, arg := range strings.Fields(usage)[1:] {
+		if strings.HasSuffix(strings.TrimSuffix(arg, "]"), "...") {
+			max = -1
+		}
+		if max >= 0 {
+			max += 1
+		}
+		if !strings.HasPrefix(arg, "[") {
+			min += 1
+		}
+	}
+	return min, max
+}
+
+// checkArgs refuses args if the named command does not take that
+// many arguments.
+func checkArgs(name string, args []string) error {
+	usage, ok := usages[name]
+	if !ok {
+		return nil
+	}
+	min, max := arity(usage)
+	if len(args) < min || max >= 0 && len(args) > max {
+		return errors.New("usage: " + usage)
+	}
+	return nil
+}
+
+// commandWord returns the word command that line starts with: letters,
+// perhaps ending in !, followed by a blank or the end of the line. It
+// returns "" if the line does not start with such a word.
+func commandWord(line string) string {
+	i := 0
+	for i < len(line) && ('a' <= line[i] && line[i] <= 'z' || 'A' <= line[i] && line[i] <= 'Z') {
+		i += 1
+	}
+	if i > 0 && i < len(line) && line[i] == '!' {
+		i += 1
+	}
+	if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+		return ""
+	}
+	return line[:i]
+}
+
+// tokens splits a command line into words at runs of blanks. Within
+// a word, '...' quotes its text as it is, "..." quotes it allowing
+// backslash escapes, and outside quotes a backslash escapes the next
+// character, so that a word can hold blanks or quotes.
+func tokens(line string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, ch := range line {
+		switch {
+		case escaped:
+			word.WriteRune(ch)
+			escaped = false
+		case ch == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(ch)
+		case ch == '\'' || ch == '"':
+			quote, inWord = ch, true
+		case unicode.IsSpace(ch):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	switch {
+	case quote != 0:
+		return nil, fmt.Errorf("missing closing %c", quote)
+	case escaped:
+		return nil, errors.New("nothing after \\")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
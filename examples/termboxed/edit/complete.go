@@ -0,0 +1,351 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// completers find the completions of an argument, by the name the
+// argument has in the command's usage line. An argument written as
+// alternatives, such as on|off, is completed from them, leaving out
+// any placeholders.
+var completers = map[string]func(prefix string) []string{
+	"file":     func(prefix string) []string { return pathNames(prefix, false) },
+	"dir":      func(prefix string) []string { return pathNames(prefix, true) },
+	"buffer":   bufferNames,
+	"name":     func(prefix string) []string { return runeNames(namedRangeNames()) },
+	"register": func(prefix string) []string { return runeNames(registerNames()) },
+}
+
+// placeholders are the words in usage lines that stand for a value
+// to be typed, such as a number, rather than being typed themselves.
+var placeholders = map[string]bool{"width": true}
+
+// complete is added to the actions here because completing command
+// names refers to the commands, which refer back to the actions.
+func init() {
+	actions["complete"] = func(ep *EditorPanel) { ep.complete() }
+}
+
+// completion is a command line word that has more than one
+// completion, which Tab steps through.
+type completion struct {
+	start      int // the rune column the word starts at
+	candidates []string
+	next       int // the candidate Tab shows next
+}
+
+// complete completes the word before the command cursor: a command
+// name, or an argument of the kind the command's usage gives. A single
+// completion is filled in; with several, as much as they share is
+// filled in and they are listed, and Tab again steps through them.
+func (ep *EditorPanel) complete() {
+	if c := ep.completing; c != nil {
+		candidate := c.candidates[c.next]
+		c.next = (c.next + 1) % len(c.candidates)
+		ep.replaceWord(c.start, escapeWord(candidate))
+		ep.status = completionList(c.candidates, candidate)
+		return
+	}
+	line := []rune(ep.commandLine())
+	col := ep.command.Where.Col
+	if col > len(line) {
+		col = len(line)
+	}
+	start, word, candidates := ep.completions(string(line[:col]))
+	switch len(candidates) {
+	case 0:
+		ep.status = "no completions"
+	case 1:
+		ep.replaceWord(start, escapeWord(candidates[0])+spacer(candidates[0]))
+		ep.status = ""
+	default:
+		if shared := commonPrefix(candidates); len(shared) > len(word) {
+			ep.replaceWord(start, escapeWord(shared))
+		}
+		ep.completing = &completion{start: start, candidates: candidates}
+		ep.status = completionList(candidates, "")
+	}
+}
+
+// replaceWord replaces the command line from rune column start to the
+// cursor with s, leaving the cursor after it.
+func (ep *EditorPanel) replaceWord(start int, s string) {
+	line := []rune(ep.commandLine())
+	col := ep.command.Where.Col
+	if col > len(line) {
+		col = len(line)
+	}
+	ep.setCommandLine(string(line[:start]) + s + string(line[col:]))
+	ep.command.Where.Col = start + len([]rune(s))
+}
+
+// completions returns where the word being completed in before (the
+// command line up to the cursor) starts, the word, unescaped, and the
+// completions of it, sorted.
+func (ep *EditorPanel) completions(before string) (start int, word string, candidates []string) {
+	// only the last command of a script is completed
+	segment := 0
+	for i, ch := range before {
+		if ch == ';' || ch == '(' {
+			segment = i + 1
+		}
+	}
+	rest := before[segment:]
+	for {
+		trimmed := strings.TrimLeft(rest, " \t")
+		w := strings.SplitN(trimmed, " ", 2)
+		if len(w) < 2 || !member(w[0], []string{"if", "then", "else", "while", "do"}) {
+			rest = trimmed
+			break
+		}
+		rest = w[1]
+	}
+	if startsAddress(rest) {
+		if _, _, after, found, err := ep.address(rest); found && err == nil {
+			rest = after
+		}
+	}
+	offset := len(before) - len(rest)
+	words, wordStart := splitWords(rest)
+	start = len([]rune(before[:offset+wordStart]))
+	word = unescapeWord(rest[wordStart:])
+	var all []string
+	if len(words) == 0 {
+		all = sortedCommands()
+	} else if kind := argumentKind(words[0], words[1:], word); strings.Contains(kind, "|") {
+		for _, alternative := range strings.Split(kind, "|") {
+			if !placeholders[alternative] {
+				all = append(all, alternative)
+			}
+		}
+	} else if f := completers[kind]; f != nil {
+		all = f(word)
+	}
+	for _, a := range all {
+		if strings.HasPrefix(a, word) {
+			candidates = append(candidates, a)
+		}
+	}
+	sort.Strings(candidates)
+	return start, word, candidates
+}
+
+// splitWords returns the words of s before its last one, and the byte
+// offset in s of the last, which may be empty. Blanks escaped by a
+// backslash do not split words.
+func splitWords(s string) (words []string, last int) {
+	escaped := false
+	for i, ch := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == ' ' || ch == '\t':
+			if i > last {
+				words = append(words, s[last:i])
+			}
+			last = i + 1
+		}
+	}
+	return words, last
+}
+
+// argumentKind returns the name, without brackets, that the usage of
+// the named command gives the next argument, after those given. Words
+// starting with - complete to the options in the usage, such as -a,
+// which do not count as arguments.
+func argumentKind(name string, given []string, word string) string {
+	usage, ok := usages[name]
+	if !ok {
+		return ""
+	}
+	options, args := []string{}, []string{}
+	for _, arg := range strings.Fields(usage)[1:] {
+		arg = strings.Trim(arg, "[]")
+		if strings.HasPrefix(arg, "-") {
+			options = append(options, arg)
+		} else {
+			args = append(args, arg)
+		}
+	}
+	if strings.HasPrefix(word, "-") {
+		return strings.Join(options, "|")
+	}
+	i := 0
+	for _, g := range given {
+		if !strings.HasPrefix(g, "-") {
+			i += 1
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	if i >= len(args) {
+		if !strings.HasSuffix(args[len(args)-1], "...") {
+			return ""
+		}
+		i = len(args) - 1
+	}
+	return strings.TrimSuffix(args[i], "...")
+}
+
+// sortedCommands returns the names of the word commands in order.
+func sortedCommands() []string {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pathNames returns the files, or only the directories if dirs is
+// set, whose names start with prefix, directories ending in a slash.
+// Names starting with a dot are left out unless prefix asks for them.
+func pathNames(prefix string, dirs bool) []string {
+	dir, base := filepath.Split(prefix)
+	readFrom := dir
+	if readFrom == "" {
+		readFrom = "."
+	}
+	entries, err := os.ReadDir(readFrom)
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		isDir := e.IsDir()
+		if !isDir && e.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(filepath.Join(readFrom, name))
+			isDir = err == nil && info.IsDir()
+		}
+		if isDir {
+			name += "/"
+		} else if dirs {
+			continue
+		}
+		names = append(names, dir+name)
+	}
+	return names
+}
+
+// bufferNames returns the file names of the open buffers, and the
+// last elements of those names that only one buffer has, as
+// findBuffer accepts.
+func bufferNames(prefix string) []string {
+	names, bases := []string{}, map[string]int{}
+	for _, j := range buffers {
+		if j.FileName() != "" {
+			names = append(names, j.FileName())
+			bases[filepath.Base(j.FileName())] += 1
+		}
+	}
+	for base, n := range bases {
+		if n == 1 && !member(base, names) {
+			names = append(names, base)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedRangeNames returns the names of the named ranges.
+func namedRangeNames() []rune {
+	names := []rune{}
+	for name := range namedRanges {
+		names = append(names, name)
+	}
+	return names
+}
+
+// registerNames returns the names of the registers in use.
+func registerNames() []rune {
+	names := []rune{}
+	for name := range registers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// runeNames returns the names as sorted strings.
+func runeNames(names []rune) []string {
+	result := []string{}
+	for _, name := range names {
+		result = append(result, string(name))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// commonPrefix returns the longest prefix the strings share.
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// spacer returns what follows a completed word: nothing after a
+// directory, so that it can be completed further, and a blank
+// otherwise.
+func spacer(word string) string {
+	if strings.HasSuffix(word, "/") {
+		return ""
+	}
+	return " "
+}
+
+// escapeWord escapes the characters of s that tokens would otherwise
+// take as blanks, quotes or escapes.
+func escapeWord(s string) string {
+	var b strings.Builder
+	for _, ch := range s {
+		if strings.ContainsRune(" \t'\"\\;", ch) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+// unescapeWord removes the backslashes escapeWord adds.
+func unescapeWord(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, ch := range s {
+		if ch == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+// completionList describes the candidates for the status bar, the
+// one shown, if any, in brackets.
+func completionList(candidates []string, shown string) string {
+	items := []string{}
+	for _, c := range candidates {
+		if c == shown {
+			c = "[" + c + "]"
+		}
+		items = append(items, c)
+	}
+	return fmt.Sprintf("%v completions: %v", len(candidates), strings.Join(items, " "))
+}
@@ -0,0 +1,312 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+	"github.com/gdamore/tcell"
+)
+
+// ConfigFile returns the name of the config file read when no other
+// is given, or "" if there is nowhere to look for one.
+func ConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "termboxed", "config.json")
+}
+
+// config holds the settings read from the config file, other than
+// those kept where they are used.
+var config struct {
+	fileName   string                  // the file last loaded
+	layout     string                  // the default layout, if set
+	extensions map[string]tabOverrides // tab settings by file extension
+}
+
+// tabOverrides are the tab settings that a config file gives, each
+// nil if it is not given.
+type tabOverrides struct {
+	Width  *int  `json:"width"`
+	Expand *bool `json:"expand"`
+	Retab  *bool `json:"retab"`
+}
+
+func (o tabOverrides) applyTo(t *tabSettings) {
+	if o.Width != nil {
+		t.width = *o.Width
+	}
+	if o.Expand != nil {
+		t.expand = *o.Expand
+	}
+	if o.Retab != nil {
+		t.retab = *o.Retab
+	}
+}
+
+// styles are the styles a config file may colour, by name.
+var styles = map[string]*tcell.Style{
+	"text":    &screen.DefaultStyle,
+	"mark":    &markStyle,
+	"numbers": &numberStyle,
+}
+
+// defaults are the settings as they are before any config is loaded.
+var defaults = struct {
+	tabs   tabSettings
+	gutter int
+	styles map[string]tcell.Style
+}{tabs, tryTagSize, copyStyles()}
+
+func copyStyles() map[string]tcell.Style {
+	result := map[string]tcell.Style{}
+	for name, style := range styles {
+		result[name] = *style
+	}
+	return result
+}
+
+// ConfigLayout returns the layout the config file asks for, or "" if
+// it does not say.
+func ConfigLayout() string {
+	return config.layout
+}
+
+// LoadConfig puts the settings in the named config file into effect,
+// in place of any loaded before. A missing file is not an error if
+// optional is set. A file that is not JSON leaves the settings as they
+// were; entries that are wrong are reported, one per line, and the rest
+// still take effect.
+func LoadConfig(fileName string, optional bool) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil && !(optional && os.IsNotExist(err)) {
+		return err
+	}
+	var entries map[string]json.RawMessage
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("%v: %v", fileName, err)
+		}
+	}
+	resetConfig()
+	config.fileName = fileName
+	problems := []string{}
+	for _, name := range sortedKeys(entries) {
+		apply := configEntries[name]
+		if apply == nil {
+			problems = append(problems, fmt.Sprintf("%v: unknown setting %q", fileName, name))
+			continue
+		}
+		for _, problem := range apply(entries[name]) {
+			problems = append(problems, fmt.Sprintf("%v: %v: %v", fileName, name, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// resetConfig puts the default settings back.
+func resetConfig() {
+	tabs = defaults.tabs
+	tryTagSize = defaults.gutter
+	for name, style := range defaults.styles {
+		*styles[name] = style
+	}
+	config.layout = ""
+	resetKeys()
+	config.extensions = map[string]tabOverrides{}
+}
+
+// configEntries apply the top-level entries of a config file, each
+// returning what was wrong with its entry.
+var configEntries = map[string]func(json.RawMessage) []string{
+	"tabs": func(raw json.RawMessage) []string {
+		var o tabOverrides
+		if err := strictly(raw, &o); err != nil {
+			return []string{err.Error()}
+		}
+		if o.Width != nil && *o.Width < 1 {
+			return []string{fmt.Sprintf("width %v is not positive", *o.Width)}
+		}
+		o.applyTo(&tabs)
+		return nil
+	},
+	"gutter": func(raw json.RawMessage) []string {
+		var width int
+		if err := strictly(raw, &width); err != nil {
+			return []string{err.Error()}
+		}
+		if width < 3 {
+			return []string{fmt.Sprintf("width %v is less than 3", width)}
+		}
+		tryTagSize = width
+		return nil
+	},
+	"layout": func(raw json.RawMessage) []string {
+		var layout string
+		if err := strictly(raw, &layout); err != nil {
+			return []string{err.Error()}
+		}
+		if layout != "shelf" && layout != "stack" {
+			return []string{fmt.Sprintf("%q is not shelf or stack", layout)}
+		}
+		config.layout = layout
+		return nil
+	},
+	"colours": func(raw json.RawMessage) []string {
+		return eachEntry(raw, func(name string, raw json.RawMessage) error {
+			style, ok := styles[name]
+			if !ok {
+				return errors.New("not a style")
+			}
+			var colours string
+			if err := strictly(raw, &colours); err != nil {
+				return err
+			}
+			base := screen.DefaultStyle
+			if name == "text" {
+				base = tcell.StyleDefault
+			}
+			coloured, err := colourStyle(base, colours)
+			if err != nil {
+				return err
+			}
+			*style = coloured
+			return nil
+		})
+	},
+	"keys": func(raw json.RawMessage) []string {
+		return eachEntry(raw, func(context string, raw json.RawMessage) error {
+			if context != "layout" && keymaps[context] == nil {
+				return errors.New("not a key context")
+			}
+			problems := eachEntry(raw, func(chord string, raw json.RawMessage) error {
+				var action string
+				if err := strictly(raw, &action); err != nil {
+					return err
+				}
+				return bindKey(context, chord, action)
+			})
+			if len(problems) > 0 {
+				return errors.New(strings.Join(problems, "; "))
+			}
+			return nil
+		})
+	},
+	"extensions": func(raw json.RawMessage) []string {
+		return eachEntry(raw, func(ext string, raw json.RawMessage) error {
+			if !strings.HasPrefix(ext, ".") {
+				return errors.New("extensions start with a dot")
+			}
+			var o tabOverrides
+			if err := strictly(raw, &o); err != nil {
+				return err
+			}
+			if o.Width != nil && *o.Width < 1 {
+				return fmt.Errorf("width %v is not positive", *o.Width)
+			}
+			config.extensions[ext] = o
+			return nil
+		})
+	},
+}
+
+// eachEntry calls apply on each entry of the object raw, returning
+// what was wrong with each entry that apply refused.
+func eachEntry(raw json.RawMessage, apply func(name string, raw json.RawMessage) error) []string {
+	var entries map[string]json.RawMessage
+	if err := strictly(raw, &entries); err != nil {
+		return []string{err.Error()}
+	}
+	problems := []string{}
+	for _, name := range sortedKeys(entries) {
+		if err := apply(name, entries[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", name, err))
+		}
+	}
+	return problems
+}
+
+// strictly decodes raw into v, refusing fields v does not have.
+func strictly(raw json.RawMessage, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+// sortedKeys returns the names in entries in order, so that problems
+// are reported in the same order every time. "text" comes first, as
+// the other styles are based on it.
+func sortedKeys(entries map[string]json.RawMessage) []string {
+	keys := []string{}
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "text") != (keys[j] == "text") {
+			return keys[i] == "text"
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// colourStyle returns base coloured as "foreground" or
+// "foreground/background" says, using W3C colour names or #rrggbb.
+func colourStyle(base tcell.Style, colours string) (tcell.Style, error) {
+	parts := strings.SplitN(colours, "/", 2)
+	for i, part := range parts {
+		c := tcell.GetColor(part)
+		if c == tcell.ColorDefault && part != "default" {
+			return base, fmt.Errorf("%q is not a colour", part)
+		}
+		if i == 0 {
+			base = base.Foreground(c)
+		} else {
+			base = base.Background(c)
+		}
+	}
+	return base, nil
+}
+
+// reloadConfig runs "config [file]", which loads the named config
+// file, or the one loaded before, in place of the current settings.
+func reloadConfig(ep *EditorPanel, blobs []string) error {
+	fileName := config.fileName
+	if len(blobs) > 1 {
+		fileName = blobs[1]
+	}
+	if fileName == "" {
+		return errors.New("no config file")
+	}
+	err := LoadConfig(fileName, false)
+	for _, p := range panels {
+		// the gutter may have changed width
+		if p.outer != nil {
+			p.ResizeTo(p.outer)
+		}
+	}
+	ep.useSettings()
+	if err != nil {
+		return errors.New(strings.Replace(err.Error(), "\n", "; ", -1))
+	}
+	ep.inform("loaded " + fileName)
+	return nil
+}
+
+// Warn shows message in the status bar of every panel.
+func Warn(message string) {
+	for _, ep := range panels {
+		ep.status = message
+	}
+}
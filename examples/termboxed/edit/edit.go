@@ -4,12 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 
 	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
 	"github.com/ehedgehog/guineapig/examples/termboxed/draw"
 	"github.com/ehedgehog/guineapig/examples/termboxed/events"
+	"github.com/ehedgehog/guineapig/examples/termboxed/keymap"
 	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
 	"github.com/ehedgehog/guineapig/examples/termboxed/text"
 	"github.com/gdamore/tcell"
@@ -17,12 +17,22 @@ import (
 import "github.com/ehedgehog/guineapig/examples/termboxed/grid"
 
 type State struct {
-	Where  grid.LineCol
+	Where  *text.Anchor
 	Buffer text.Buffer
-	Marked grid.MarkedRange
+	Marked *text.MarkedRange
 	Offset grid.Offset
 }
 
+// NewState returns a State editing b with the cursor at its start
+// and nothing marked. The cursor moves past text inserted at it.
+func NewState(b text.Buffer) State {
+	return State{
+		Where:  b.NewAnchor(grid.LineCol{}, text.MoveAfter),
+		Buffer: b,
+		Marked: text.NewMarkedRange(b),
+	}
+}
+
 type Panel struct {
 	Canvas    screen.Canvas
 	PaintFunc func(*Panel)
@@ -56,35 +66,112 @@ type EditorPanel struct {
 	current *State
 	main    State
 	command State
+	message string // reported in place of OK when a command succeeds
+	status  string // shown in the bottom bar
+
+	lastSearch *searching     // repeated by ctrl-N
+	confirm    *confirming    // a substitution waiting for y/n at each match
+	quitAsked  bool           // the last key was a refused quit
+	pending    keymap.Chord   // the keys so far of an unfinished chord
+	describing bool           // the next key is described rather than done
+	noticed    text.Stamp     // the latest change to the file on disk reported
+	addressed  bool           // the command running was given an address
+	recall     int            // how far back in the history the command line is
+	draft      string         // the command line as typed before recalling
+	hunt       *historySearch // a search back through the history under way
+	completing *completion    // the completions Tab steps through, if any
+
+	listing *listing                       // the directory shown in the main buffer, if it is one
+	choices []*text.Journal                // the buffers listed in the main buffer, if it is the buffer list
+	places  map[*text.Journal]grid.LineCol // where the cursor was in each buffer shown before
+	spawned events.Handler                 // a panel to be put beside this one
+	outer   screen.Canvas                  // the canvas last given to ResizeTo
 }
 
 func (ep *EditorPanel) New() events.Handler {
 	return NewEditorPanel()
 }
 
+// Spawned returns the panel a command has asked to be put beside
+// this one, if any.
+func (ep *EditorPanel) Spawned() events.Handler {
+	h := ep.spawned
+	ep.spawned = nil
+	return h
+}
+
 func NewEditorPanel() events.Handler {
-	mb := text.NewBuffer(func(b text.Buffer, s string) error { return nil })
+	return newEditorPanel(register(newMainBuffer()))
+}
+
+// newMainBuffer returns an empty buffer of the kind used for the text
+// of an EditorPanel.
+func newMainBuffer() text.Buffer {
+	return text.NewBuffer(func(b text.Buffer, s string) error { return nil }, text.WithRope())
+}
+
+// newEditorPanel returns an EditorPanel showing j.
+func newEditorPanel(j *text.Journal) *EditorPanel {
 	var ep *EditorPanel
 	ep = &EditorPanel{
-		main: State{Buffer: mb},
-
-		command: State{Buffer: text.NewBuffer(func(b text.Buffer, s string) error {
-			content := b.Expose()
-			line := ep.command.Where.Line
-			blobs := strings.Split(content[line], " ")
-			command := commands[blobs[0]]
-			if command == nil {
-				return errors.New("not a command: " + blobs[0])
-			} else {
-				return command(ep, blobs)
-			}
-		}),
-		},
+		command: NewState(text.NewBuffer(func(b text.Buffer, s string) error {
+			return execute(ep, s)
+		})),
 	}
-	ep.current = &ep.main
+	ep.show(j)
+	panels = append(panels, ep)
 	return ep
 }
 
+// execute runs the command line s, which may be a script of several
+// commands (see parseScript).
+func execute(ep *EditorPanel, s string) error {
+	script, err := parseScript(s)
+	if err != nil {
+		return err
+	}
+	return script.run(ep)
+}
+
+// runCommand runs the line for one command, which may start with an
+// address (see runAddressed). Blanks before it are ignored.
+func runCommand(ep *EditorPanel, s string) error {
+	line := strings.TrimLeft(s, " \t")
+	first, last, rest, found, err := ep.address(line)
+	if err != nil {
+		return err
+	}
+	if found {
+		return ep.runAddressed(first, last, rest)
+	}
+	return runLine(ep, line)
+}
+
+// runLine runs a command line with no address. A line starting with a
+// word command is split into words, quoted as tokens allows, and its
+// arguments checked against the command's usage; any other line
+// starting with one of the charCommands is handed to it whole.
+func runLine(ep *EditorPanel, line string) error {
+	if line == "" {
+		return errors.New("no command")
+	}
+	name := commandWord(line)
+	if command := commands[name]; command != nil {
+		args, err := tokens(line[len(name):])
+		if err != nil {
+			return err
+		}
+		if err := checkArgs(name, args); err != nil {
+			return err
+		}
+		return command(ep, append([]string{name}, args...))
+	}
+	if charCommands[line[0]] != nil {
+		return charCommands[line[0]](ep, line)
+	}
+	return errors.New("not a command: " + strings.Fields(line)[0])
+}
+
 func (ep *EditorPanel) Geometry() grid.Geometry {
 	minw := 2
 	maxw := 1000
@@ -93,187 +180,162 @@ func (ep *EditorPanel) Geometry() grid.Geometry {
 	return grid.Geometry{MinWidth: minw, MaxWidth: maxw, MinHeight: minh, MaxHeight: maxh}
 }
 
-func readIntoBuffer(ep *EditorPanel, b text.Buffer, fileName string) error {
-	f, err := os.Open(fileName)
-	if err != nil {
-		return err
+// journal returns the undo journal wrapped around the main buffer.
+func (ep *EditorPanel) journal() *text.Journal {
+	return ep.main.Buffer.(*text.Journal)
+}
+
+// place returns the main cursor and marked range as undo restores them.
+func (ep *EditorPanel) place() text.Place {
+	first, last := ep.main.Marked.Range()
+	return text.Place{Where: ep.main.Where.LineCol, First: first, Last: last}
+}
+
+// restore moves the main cursor and marked range back to place.
+func (ep *EditorPanel) restore(place text.Place) {
+	ep.main.Where.LineCol = place.Where
+	if place.First < 0 {
+		ep.main.Marked.Clear()
+	} else {
+		ep.main.Marked.SetRange(place.First, place.Last)
+	}
+}
+
+func undo(ep *EditorPanel) error {
+	place, ok := ep.journal().Undo(ep.place())
+	if !ok {
+		return errors.New("nothing to undo")
+	}
+	ep.restore(place)
+	return nil
+}
+
+func redo(ep *EditorPanel) error {
+	place, ok := ep.journal().Redo(ep.place())
+	if !ok {
+		return errors.New("nothing to redo")
+	}
+	ep.restore(place)
+	return nil
+}
+
+// stepKind returns the kind of undo step that a key doing action, or
+// typing a rune, belongs to. Consecutive typing in the main buffer is
+// undone as one step; every other key starts a step of its own.
+func (ep *EditorPanel) stepKind(action string, typed bool) string {
+	if ep.current != &ep.main {
+		return ""
 	}
-	defer f.Close()
-	w, err := b.ReadFromFile(ep.main.Where, fileName, f)
-	ep.main.Where = w
-	return err
+	if typed || typing[action] {
+		return "typing"
+	}
+	return ""
 }
 
 var commands = map[string]func(*EditorPanel, []string) error{
-	"r": func(ep *EditorPanel, blobs []string) error {
-		b := ep.main.Buffer
-		return readIntoBuffer(ep, b, blobs[1])
-	},
-	"mr": func(ep *EditorPanel, blobs []string) error {
-		b := ep.main.Buffer
-		if ep.main.Marked.IsActive() {
-			target := ep.main.Where.Line
-			first, last := ep.main.Marked.Range()
-			if first <= target && target <= last {
-				return errors.New("range overlaps target")
-			}
-			b.MoveLines(ep.main.Where, first, last)
-			ep.main.Where.Line = ep.main.Marked.MoveAfter(target)
-			return nil
-		} else {
-			return errors.New("no marked range")
-		}
-	},
-	"w": func(ep *EditorPanel, blobs []string) error {
-		b := ep.main.Buffer
-		return b.WriteToFile(blobs[1:])
-	},
+	"r":  readFile,
+	"ri": readOverRange,
+	"mr": moveRange,
+	"w":  writeFile,
+	"w!": writeFile,
+	"wr": writeRange,
+	"ar": writeRange,
 	"d": func(ep *EditorPanel, blobs []string) error {
+		if ep.addressed {
+			return deleteRange(ep, blobs)
+		}
 		b := ep.main.Buffer
-		lineNumber := ep.main.Where.Line
-		b.DeleteLine(ep.main.Where)
-		ep.main.Marked.RemoveLine(lineNumber)
+		b.DeleteLine(ep.main.Where.LineCol)
 		return nil
 	},
-	"dr": func(ep *EditorPanel, blobs []string) error {
-		if ep.main.Marked.IsActive() {
-			b := ep.main.Buffer
-			first, last := ep.main.Marked.Range()
-			ep.current.Where = b.DeleteLines(ep.current.Where, first, last)
-			ep.main.Marked.Clear()
-			return nil
-		} else {
-			return errors.New("no marked range")
+	"dr":       deleteRange,
+	"cr":       copyRange,
+	"p":        paste,
+	"sr":       setRange,
+	"xr":       swapRange,
+	"lr":       listRanges,
+	"tabs":     setTabs,
+	"q":        quit,
+	"q!":       forceQuit,
+	"wq":       writeAllAndQuit,
+	"reload":   reload,
+	"diff":     diffFile,
+	"watch":    watch,
+	"e":        editFile,
+	"b":        switchBuffer,
+	"bd":       closeBuffer,
+	"bd!":      closeBuffer,
+	"bl":       listBuffers,
+	"session":  saveSession,
+	"config":   reloadConfig,
+	"describe": describeKey,
+	"search":   findPattern,
+	"mark":     markLines,
+	"backup": func(ep *EditorPanel, blobs []string) error {
+		modes := map[string]text.BackupMode{"none": text.NoBackup, "bak": text.SimpleBackup, "numbered": text.NumberedBackup}
+		mode, ok := modes[blobs[1]]
+		if !ok {
+			return errors.New("not a backup mode: " + blobs[1])
 		}
+		text.Backups = mode
+		return nil
+	},
+	"u": func(ep *EditorPanel, blobs []string) error {
+		return undo(ep)
+	},
+	"redo": func(ep *EditorPanel, blobs []string) error {
+		return redo(ep)
 	},
 }
 
 func (ep *EditorPanel) Key(e *tcell.EventKey) error {
-	b := ep.current.Buffer
-	if e.Key() != tcell.KeyRune {
-		switch e.Key() {
-
-		case 0:
-			// nothing
-
-		case tcell.KeyF1:
-			ep.current = &ep.command
-			ep.command.Buffer.Return(ep.command.Where)
-			ep.current.Where = grid.LineCol{Line: ep.command.Where.Line + 1, Col: 0}
-
-		case tcell.KeyF2:
-			ep.command.Where, _ = ep.command.Buffer.Execute(ep.command.Where)
-
-		case tcell.KeyCtrlB:
-			if ep.current == &ep.main {
-				ep.current = &ep.command
-			} else {
-				ep.current = &ep.main
-			}
-
-		case KeySpace:
-			b.Insert(ep.current.Where, ' ')
-			ep.current.Where.RightOne()
-
-		case tcell.KeyBackspace2:
-			ep.current.Where = b.DeleteBack(ep.current.Where)
-
-		case tcell.KeyDelete:
-			ep.current.Where = b.DeleteForward(ep.current.Where)
-
-		case tcell.KeyF3:
-			ep.main.Marked.SetLow(ep.main.Where.Line)
-
-		case tcell.KeyF4:
-			ep.main.Marked.SetHigh(ep.main.Where.Line)
-
-		case tcell.KeyPgUp:
-			where := ep.current.Where
-			vo := ep.current.Offset.Vertical
-			if where.Line-vo == 0 {
-				top := bounds.Max(0, where.Line-ep.textBox.Size().Height)
-				ep.current.Where = grid.LineCol{top, where.Col}
-			} else {
-				ep.current.Where = grid.LineCol{vo, where.Col}
-			}
-
-		case tcell.KeyPgDn:
-			where := ep.current.Where
-			vo := ep.current.Offset.Vertical
-			height := ep.textBox.Size().Height
-			if where.Line-vo == height-1 {
-				// forward one page
-				bot := where.Line + height
-				ep.current.Where = grid.LineCol{bot, where.Col}
-			} else {
-				// bottom of this page
-				ep.current.Where = grid.LineCol{vo + height - 1, where.Col}
-			}
-
-		case tcell.KeyEnd:
-			where := ep.current.Where
-			if where.Col == 0 {
-				contents := b.Expose()
-				line := contents[ep.current.Where.Line]
-				where.Col = len(line)
-			} else {
-				where.Col = 0
-			}
-			ep.current.Where = where
-
-		case tcell.KeyEnter:
-			if ep.current == &ep.main {
-				ep.current.Where = b.Return(ep.current.Where)
-				ep.main.Marked.Return(ep.current.Where.Line)
-			} else {
-				_, err := b.Execute(ep.current.Where)
-				if err == nil {
-					report(ep, b, "OK")
-				} else {
-					report(ep, b, err.Error())
-				}
-				ep.current = &ep.main
-			}
-
-		case tcell.KeyRight:
-			ep.current.Where.RightOne()
-
-		case tcell.KeyUp:
-			ep.current.Where.UpOne()
-
-		case tcell.KeyDown:
-			ep.current.Where.DownOne()
-
-		case tcell.KeyLeft:
-			ep.current.Where.LeftOne()
-
-		default:
-			report := fmt.Sprintf("<key: %#d>\n", uint(e.Key()))
-			for _, ch := range report {
-				b.Insert(ep.current.Where, rune(ch))
-				ep.current.Where.RightOne()
-			}
-		}
-	} else {
-		b.Insert(ep.current.Where, e.Rune())
-		ep.current.Where.RightOne()
+	ep.useSettings()
+	if ep.confirm != nil {
+		ep.journal().Begin("substitute", ep.place())
+		ep.confirmKey(e)
+		return nil
+	}
+	if ep.hunt != nil && ep.huntKey(e) {
+		return nil
+	}
+	if ep.describing {
+		ep.describeNext(e)
+		return nil
 	}
+	action, typed := ep.lookupKey(e)
+	if action != "complete" {
+		ep.completing = nil
+	}
+	if action == "" && !typed {
+		return nil
+	}
+	ep.journal().Begin(ep.stepKind(action, typed), ep.place())
+	quitAsked := ep.quitAsked
+	ep.quitAsked = false
+	if typed {
+		ep.current.Buffer.Insert(ep.current.Where.LineCol, e.Rune())
+		return nil
+	}
+	if action == "quit" {
+		ep.quitAsked = quitAsked
+	}
+	ep.doAction(action)
 	return nil
 }
 
+// inform sets the message reported if the current command succeeds.
+func (ep *EditorPanel) inform(message string) {
+	ep.message = message
+}
+
 func report(ep *EditorPanel, b text.Buffer, message string) {
-	b.Insert(ep.current.Where, ' ')
-	ep.current.Where.RightOne()
-	b.Insert(ep.current.Where, '(')
-	ep.current.Where.RightOne()
+	b.Insert(ep.current.Where.LineCol, ' ')
+	b.Insert(ep.current.Where.LineCol, '(')
 	for _, rune := range message {
-		b.Insert(ep.current.Where, rune)
-		ep.current.Where.RightOne()
+		b.Insert(ep.current.Where.LineCol, rune)
 	}
-	b.Insert(ep.current.Where, ')')
-	ep.current.Where.RightOne()
-	b.Insert(ep.current.Where, ' ')
-	ep.current.Where.RightOne()
+	b.Insert(ep.current.Where.LineCol, ')')
+	b.Insert(ep.current.Where.LineCol, ' ')
 }
 
 func (ep *EditorPanel) Mouse(e *tcell.EventMouse) error {
@@ -283,37 +345,61 @@ func (ep *EditorPanel) Mouse(e *tcell.EventMouse) error {
 	if false {
 		log.Println("EditorPanel", "xy:", x, y, "wh:", w, h)
 	}
+	ep.useSettings()
+	ep.journal().Begin("", ep.place())
 	if 0 < x && x < w+1 && 1 < y && y < h+2 {
 		// log.Println("  main")
 		ep.current = &ep.main
-		ep.current.Where = grid.LineCol{y - 1, x - 1}
+		ep.current.Where.LineCol = grid.LineCol{y - 1, x - 1}
 
 		// hack to adjust beteen buffer & cancas coordinates.
 		ep.current.Where.Line -= 1
 		ep.current.Where.Line += ep.current.Offset.Vertical
-		ep.current.Where.Col -= 6
+		ep.current.Where.Col -= tryTagSize
+		ep.current.Where.Col += ep.current.Offset.Horizontal
+		ep.current.Where.LineCol = bufferWhere(ep.main.Buffer, ep.current.Where.LineCol)
 
 	} else if x >= delta && y == 1 {
 		// log.Println("  command")
-		ep.command.Where = grid.LineCol{0, x - delta}
+		ep.command.Where.LineCol = bufferWhere(ep.command.Buffer, grid.LineCol{0, x - delta})
 		ep.current = &ep.command
 	}
 	return nil
 }
 
 func (ep *EditorPanel) AdjustScrolling() {
+	ep.adjustScrolling(ep.current)
+}
+
+// adjustScrolling scrolls s so that its cursor is in view. The cursor
+// is kept off the edge columns, where the continuation indicators go,
+// unless the text is scrolled fully left. It does nothing if the panel
+// has not yet been given a size.
+func (ep *EditorPanel) adjustScrolling(s *State) {
+	if ep.textBox == nil {
+		return
+	}
 	size := ep.textBox.Size()
-	line := ep.current.Where.Line
+	line := s.Where.Line
 	h := size.Height
-	if line < ep.current.Offset.Vertical {
-		ep.current.Offset.Vertical = line
+	if line < s.Offset.Vertical {
+		s.Offset.Vertical = line
 	}
-	if line > ep.current.Offset.Vertical+h-1 {
-		ep.current.Offset.Vertical = line - h + 1
+	if line > s.Offset.Vertical+h-1 {
+		s.Offset.Vertical = line - h + 1
+	}
+	col := displayWhere(s.Buffer, s.Where.LineCol).Col
+	w := size.Width - tryTagSize
+	if col < s.Offset.Horizontal+1 {
+		s.Offset.Horizontal = bounds.Max(col-1, 0)
+	}
+	if col > s.Offset.Horizontal+w-2 {
+		s.Offset.Horizontal = bounds.Max(col-w+2, 0)
 	}
 }
 
 func (ep *EditorPanel) Paint() error {
+	ep.useSettings()
 	ep.AdjustScrolling()
 	ep.topBar.Paint()
 	ep.bottomBar.Paint()
@@ -332,7 +418,8 @@ func textPainterFor(tb *TextBox, s *State) func(*Panel) {
 		if v < 0 {
 			v = 0
 		}
-		s.Buffer.PutLines(tb.lineContent, v, h)
+		s.Buffer.PutLines(tb.lineContent, v, h, s.Offset.Horizontal)
+		paintContinuations(tb.lineContent, s.Buffer, v, h, s.Offset.Horizontal)
 
 		if s.Marked.IsActive() {
 			first, last := s.Marked.Range()
@@ -340,12 +427,11 @@ func textPainterFor(tb *TextBox, s *State) func(*Panel) {
 				tb.lineInfo.SetCell(grid.LineCol{line, tryTagSize - 1}, '║', markStyle)
 			}
 		}
+		paintNamedRanges(tb.lineInfo, s.Buffer, tryTagSize-2, v, h)
 
 		ln := 0
-		numberStyle := screen.DefaultStyle
-		//
 		for i := v; i < v+h; i += 1 {
-			s := fmt.Sprintf("%4v", i)
+			s := fmt.Sprintf("%*v", tryTagSize-2, i)
 			for j, ch := range s {
 				tb.lineInfo.SetCell(grid.LineCol{ln, j}, rune(ch), numberStyle)
 			}
@@ -354,27 +440,46 @@ func textPainterFor(tb *TextBox, s *State) func(*Panel) {
 	}
 }
 
+// paintContinuations marks the edges of c where lines top to top+h-1
+// of b, shown scrolled left by left cells, run beyond them.
+func paintContinuations(c screen.Canvas, b text.Buffer, top, h, left int) {
+	w := c.Size().Width
+	for row := 0; row < h && top+row < b.LineCount(); row += 1 {
+		width := text.DisplayWidth(b.Line(top + row))
+		if left > 0 && width > 0 {
+			c.SetCell(grid.LineCol{Line: row, Col: 0}, draw.Glyph_more_left, markStyle)
+		}
+		if width-left > w {
+			c.SetCell(grid.LineCol{Line: row, Col: w - 1}, draw.Glyph_more_right, markStyle)
+		}
+	}
+}
+
 func rightPainterFor(s *State) func(*Panel) {
 	return func(p *Panel) {
-		b := s.Buffer
-		content := b.Expose()
 		line := s.Where.Line
-		length := bounds.Max(line, len(content))
+		length := bounds.Max(line, s.Buffer.LineCount())
 		draw.Scrollbar(p.Canvas, draw.ScrollInfo{length, line})
 	}
 }
 
-func bottomPainter(p *Panel) {
-	c := p.Canvas
-	w := c.Size().Width
-	c.SetCell(grid.LineCol{Col: 0, Line: 0}, draw.Glyph_corner_bl, screen.DefaultStyle)
-	for i := 1; i < w; i += 1 {
-		c.SetCell(grid.LineCol{Col: i, Line: 0}, draw.Glyph_hbar, screen.DefaultStyle)
+func bottomPainterFor(ep *EditorPanel) func(*Panel) {
+	return func(p *Panel) {
+		c := p.Canvas
+		w := c.Size().Width
+		c.SetCell(grid.LineCol{Col: 0, Line: 0}, draw.Glyph_corner_bl, screen.DefaultStyle)
+		for i := 1; i < w; i += 1 {
+			c.SetCell(grid.LineCol{Col: i, Line: 0}, draw.Glyph_hbar, screen.DefaultStyle)
+		}
+		if ep.status != "" {
+			screen.PutString(c, 2, 0, "─┤ "+ep.status+" ├", screen.DefaultStyle)
+		}
+		c.SetCell(grid.LineCol{Col: w - 1, Line: 0}, draw.Glyph_corner_br, screen.DefaultStyle)
 	}
-	c.SetCell(grid.LineCol{Col: w - 1, Line: 0}, draw.Glyph_corner_br, screen.DefaultStyle)
 }
 
-func topPainterFor(s *State) func(*Panel) {
+func topPainterFor(ep *EditorPanel) func(*Panel) {
+	s := &ep.command
 	return func(p *Panel) {
 		c := p.Canvas
 		w := c.Size().Width
@@ -383,9 +488,12 @@ func topPainterFor(s *State) func(*Panel) {
 			c.SetCell(grid.LineCol{Col: i, Line: 0}, draw.Glyph_hbar, screen.DefaultStyle)
 		}
 		screen.PutString(c, 2, 0, "─┤ ", screen.DefaultStyle)
+		if ep.main.Buffer.Modified() {
+			c.SetCell(grid.LineCol{Col: 1, Line: 0}, '*', markStyle)
+		}
 		c.SetCell(grid.LineCol{Col: w - 1, Line: 0}, draw.Glyph_corner_tr, screen.DefaultStyle)
 		tline := s.Where.Line
-		s.Buffer.PutLines(screen.NewSubCanvas(c, delta, 0, w-delta-2, 1), tline, 1)
+		s.Buffer.PutLines(screen.NewSubCanvas(c, delta, 0, w-delta-2, 1), tline, 1, 0)
 	}
 }
 
@@ -398,20 +506,23 @@ func leftPainter(p *Panel) {
 }
 
 func (ep *EditorPanel) ResizeTo(outer screen.Canvas) error {
+	ep.outer = outer
 	size := outer.Size()
 	w, h := size.Width, size.Height
 
 	ep.leftBar = &Panel{Canvas: screen.NewSubCanvas(outer, 0, 1, 1, h-2), PaintFunc: leftPainter}
 	ep.rightBar = &Panel{Canvas: screen.NewSubCanvas(outer, w-1, 1, 1, h-2), PaintFunc: rightPainterFor(&ep.main)}
-	ep.topBar = &Panel{Canvas: screen.NewSubCanvas(outer, 0, 0, w, 1), PaintFunc: topPainterFor(&ep.command)}
-	ep.bottomBar = &Panel{Canvas: screen.NewSubCanvas(outer, 0, h-1, w, 1), PaintFunc: bottomPainter}
+	ep.topBar = &Panel{Canvas: screen.NewSubCanvas(outer, 0, 0, w, 1), PaintFunc: topPainterFor(ep)}
+	ep.bottomBar = &Panel{Canvas: screen.NewSubCanvas(outer, 0, h-1, w, 1), PaintFunc: bottomPainterFor(ep)}
 
 	textBox := NewTextBox(ep, outer, 1, 1, w-2, h-2)
 	ep.textBox = &Panel{Canvas: textBox, PaintFunc: textPainterFor(textBox, &ep.main)}
 	return nil
 }
 
-const tryTagSize = 6
+// tryTagSize is the width of the gutter left of the text, where the
+// line numbers and marks go.
+var tryTagSize = 6
 
 func NewTextBox(ep *EditorPanel, outer screen.Canvas, dx, dy, w, h int) *TextBox {
 	sub := screen.NewSubCanvas(outer, dx, dy, w, h)
@@ -440,6 +551,8 @@ func (s *TextBox) SetCell(where grid.LineCol, glyph rune, st tcell.Style) {
 
 var markStyle = screen.DefaultStyle.Foreground(tcell.ColorRed)
 
+var numberStyle = screen.DefaultStyle
+
 var hereStyle = screen.DefaultStyle.Foreground(tcell.ColorRed)
 
 func (t *TextBox) SetCursor(where grid.LineCol) {
@@ -448,11 +561,37 @@ func (t *TextBox) SetCursor(where grid.LineCol) {
 }
 
 func (ep *EditorPanel) SetCursor() error {
+	ep.useSettings()
 	if ep.current == &ep.main {
-		ep.textBox.SetCursor(ep.current.Where.LineMinus(ep.current.Offset.Vertical))
+		where := displayWhere(ep.main.Buffer, ep.main.Where.LineCol)
+		ep.textBox.SetCursor(grid.LineCol{
+			Line: where.Line - ep.current.Offset.Vertical,
+			Col:  where.Col - ep.current.Offset.Horizontal,
+		})
 	} else {
-		where := ep.command.Where
+		where := displayWhere(ep.command.Buffer, ep.command.Where.LineCol)
 		ep.topBar.SetCursor(grid.LineCol{0, where.Col + delta})
 	}
 	return nil
 }
+
+// lineOf returns line n of b, or the empty string if b does not
+// have a line n.
+func lineOf(b text.Buffer, n int) string {
+	if 0 <= n && n < b.LineCount() {
+		return b.Line(n)
+	}
+	return ""
+}
+
+// displayWhere converts the rune column of where in b to the display
+// column at which it appears.
+func displayWhere(b text.Buffer, where grid.LineCol) grid.LineCol {
+	return grid.LineCol{Line: where.Line, Col: text.DisplayColumn(lineOf(b, where.Line), where.Col)}
+}
+
+// bufferWhere converts the display column of where in b to the rune
+// column shown there.
+func bufferWhere(b text.Buffer, where grid.LineCol) grid.LineCol {
+	return grid.LineCol{Line: where.Line, Col: text.ColumnAt(lineOf(b, where.Line), where.Col)}
+}
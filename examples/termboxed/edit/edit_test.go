@@ -0,0 +1,1112 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/layouts"
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+	"github.com/gdamore/tcell"
+)
+
+// newTestPanel returns an unsized EditorPanel whose main buffer
+// holds the given lines.
+func newTestPanel(t *testing.T, lines ...string) *EditorPanel {
+	t.Helper()
+	ep := NewEditorPanel().(*EditorPanel)
+	content := strings.Join(lines, "\n") + "\n"
+	if _, err := ep.main.Buffer.ReadFromFile(grid.LineCol{}, "", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	return ep
+}
+
+// run executes a command line as if typed into the command buffer.
+func run(t *testing.T, ep *EditorPanel, command string) error {
+	t.Helper()
+	ep.journal().Begin("", ep.place())
+	ep.message = "OK"
+	return execute(ep, command)
+}
+
+// freshRegisters gives a test its own named ranges and registers.
+func freshRegisters(t *testing.T) {
+	savedRanges, savedRegisters := namedRanges, registers
+	namedRanges, registers = map[rune]*text.MarkedRange{}, map[rune][]string{}
+	t.Cleanup(func() { namedRanges, registers = savedRanges, savedRegisters })
+}
+
+// freshPanels gives a test its own lists of panels and buffers.
+func freshPanels(t *testing.T) {
+	savedPanels, savedBuffers, savedQuitting := panels, buffers, quitting
+	panels, buffers, quitting = nil, nil, false
+	t.Cleanup(func() { panels, buffers, quitting = savedPanels, savedBuffers, savedQuitting })
+}
+
+func mainContent(ep *EditorPanel) string {
+	return strings.Join(ep.main.Buffer.Expose(), "|")
+}
+
+func eq(t *testing.T, oops string, a, b interface{}) {
+	t.Helper()
+	if a != b {
+		t.Errorf("%s: got %v, expected %v.", oops, a, b)
+	}
+}
+
+func TestDeleteIntoAndPasteFromRegister(t *testing.T) {
+	freshRegisters(t)
+	ep := newTestPanel(t, "0", "1", "2", "3", "4")
+	ep.main.Marked.SetRange(1, 2)
+	if err := run(t, ep, "dr q"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "after delete", mainContent(ep), "0|3|4")
+	ep.main.Where.Line = 2
+	if err := run(t, ep, "p q"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "after paste", mainContent(ep), "0|3|4|1|2")
+	first, last := ep.main.Marked.Range()
+	eq(t, "pasted lines are marked", [2]int{first, last}, [2]int{3, 4})
+	eq(t, "unknown register", run(t, ep, "p z") != nil, true)
+}
+
+func TestNamedRangesSwapAndFollowEdits(t *testing.T) {
+	freshRegisters(t)
+	ep := newTestPanel(t, "0", "1", "2", "3", "4", "5")
+	ep.main.Marked.SetRange(4, 5)
+	run(t, ep, "sr a")
+	ep.main.Marked.SetRange(0, 1)
+	ep.main.Buffer.DeleteLine(grid.LineCol{Line: 2})
+	if err := run(t, ep, "xr a"); err != nil {
+		t.Fatal(err)
+	}
+	first, last := ep.main.Marked.Range()
+	eq(t, "swapped in range a", [2]int{first, last}, [2]int{3, 4})
+	first, last = namedRanges['a'].Range()
+	eq(t, "range a now holds old marked range", [2]int{first, last}, [2]int{0, 1})
+	run(t, ep, "lr")
+	eq(t, "listing", ep.message, "a 0-1")
+
+	run(t, ep, "sr b")
+	namedRanges['b'].Clear()
+	run(t, ep, "xr b")
+	eq(t, "stale range swapped in", ep.main.Marked.IsActive(), false)
+	first, last = namedRanges['b'].Range()
+	eq(t, "marked range kept under b", [2]int{first, last}, [2]int{3, 4})
+	run(t, ep, "xr a")
+	eq(t, "no marked range is not kept", namedRanges['a'] == nil, true)
+}
+
+func TestSearchCommands(t *testing.T) {
+	ep := newTestPanel(t, "func main() {", "\tFoo(1)", "}", "func foo() {", "}")
+	find := func(command string, line, col int) {
+		t.Helper()
+		if err := run(t, ep, command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+		eq(t, command+": cursor", ep.main.Where.LineCol, grid.LineCol{Line: line, Col: col})
+	}
+	find("/foo", 3, 5)
+	find("/foo/i", 1, 1)
+	find("/", 3, 5)
+	find("?^func?r", 3, 0)
+	find("?", 0, 0)
+	find("/a/n", 0, 6)
+	eq(t, "no wrap backward", run(t, ep, "?foo?n") != nil, true)
+	ep.main.Marked.SetRange(2, 4)
+	find("/}/m", 2, 0)
+	find("/", 4, 0)
+	eq(t, "unknown flag", run(t, ep, "/x/q") != nil, true)
+	eq(t, "bad regexp", run(t, ep, "/(/r") != nil, true)
+}
+
+func TestSubstitute(t *testing.T) {
+	ep := newTestPanel(t, "cat cat", "dog cat", "cat", "bird")
+	ep.main.Where.LineCol = grid.LineCol{}
+	if err := run(t, ep, "s/cat/dog/"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "first match on cursor line", mainContent(ep), "dog cat|dog cat|cat|bird")
+	eq(t, "count reported", ep.status, "1 replacement")
+	ep.main.Marked.SetRange(0, 1)
+	run(t, ep, "s/CAT/[&]/gim")
+	eq(t, "every match in marked range", mainContent(ep), "dog [cat]|dog [cat]|cat|bird")
+	run(t, ep, `s,(\w+) \[(\w+)\],\2 \1,a`)
+	eq(t, "groups over whole buffer", mainContent(ep), "cat dog|cat dog|cat|bird")
+	eq(t, "count over whole buffer", ep.message, "2 replacements")
+	eq(t, "unknown flag", run(t, ep, "s/a/b/z") != nil, true)
+	eq(t, "word commands still win", run(t, ep, "sr a"), nil)
+}
+
+func TestSubstituteConfirm(t *testing.T) {
+	ep := newTestPanel(t, "a a", "b", "a")
+	if err := run(t, ep, "s/a/x/gac"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "nothing changed yet", mainContent(ep), "a a|b|a")
+	eq(t, "cursor on first match", ep.main.Where.LineCol, grid.LineCol{Line: 0, Col: 0})
+	press := func(ch rune) { ep.Key(tcell.NewEventKey(tcell.KeyRune, ch, tcell.ModNone)) }
+	press('n')
+	eq(t, "cursor on second match", ep.main.Where.LineCol, grid.LineCol{Line: 0, Col: 2})
+	press('y')
+	eq(t, "second match replaced", mainContent(ep), "a x|b|a")
+	eq(t, "cursor on third match", ep.main.Where.LineCol, grid.LineCol{Line: 2, Col: 0})
+	press('y')
+	eq(t, "third match replaced", mainContent(ep), "a x|b|x")
+	eq(t, "confirmation over", ep.confirm == nil, true)
+	eq(t, "count reported", ep.status, "2 replacements")
+	undo(ep)
+	eq(t, "confirmed replacements undo together", mainContent(ep), "a a|b|a")
+
+	ep = newTestPanel(t, "ab")
+	if err := run(t, ep, `s/\Bb/X/gac`); err != nil {
+		t.Fatal(err)
+	}
+	ep.Key(tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModNone))
+	eq(t, "match that needs what precedes it", mainContent(ep), "aX")
+	eq(t, "confirmation over after it", ep.confirm == nil, true)
+}
+
+// sizedCanvas is a screen.Canvas that only has a size.
+type sizedCanvas grid.Size
+
+func (c sizedCanvas) Size() grid.Size                                    { return grid.Size(c) }
+func (c sizedCanvas) SetCursor(where grid.LineCol)                       {}
+func (c sizedCanvas) SetCell(where grid.LineCol, ch rune, s tcell.Style) {}
+
+func TestHorizontalScrolling(t *testing.T) {
+	ep := newTestPanel(t, strings.Repeat("x", 40), "short")
+	// 8 columns of text once the borders and gutter are taken off.
+	ep.ResizeTo(sizedCanvas{Width: 2 + tryTagSize + 8, Height: 10})
+	ep.main.Where.LineCol = grid.LineCol{Line: 0, Col: 30}
+	ep.AdjustScrolling()
+	eq(t, "scrolled right", ep.main.Offset.Horizontal, 24)
+	ep.Mouse(tcell.NewEventMouse(1+tryTagSize+3, 2, tcell.Button1, tcell.ModNone))
+	eq(t, "click allows for offset", ep.main.Where.LineCol, grid.LineCol{Line: 0, Col: 27})
+	ep.main.Where.LineCol = grid.LineCol{Line: 1, Col: 2}
+	ep.AdjustScrolling()
+	eq(t, "scrolled back left", ep.main.Offset.Horizontal, 1)
+	ep.main.Where.Col = 0
+	ep.AdjustScrolling()
+	eq(t, "scrolled fully left", ep.main.Offset.Horizontal, 0)
+}
+
+func TestTabSettings(t *testing.T) {
+	savedTabs, savedWidth := tabs, screen.TabWidth
+	defer func() { tabs, screen.TabWidth = savedTabs, savedWidth }()
+	ep := newTestPanel(t, "ab", "        x")
+	ep.main.Where.LineCol = grid.LineCol{Line: 0, Col: 1}
+	tab := tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone)
+	ep.Key(tab)
+	eq(t, "tab inserted", mainContent(ep), "a\tb|        x")
+	if err := run(t, ep, "tabs 8 expand retab"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "settings reported", ep.message, "tabs 8 expand retab")
+	ep.Key(tab)
+	eq(t, "spaces to next stop", mainContent(ep), "a\t        b|        x")
+	name := filepath.Join(t.TempDir(), "f")
+	ep.main.Where.LineCol = grid.LineCol{Line: 1, Col: 8}
+	if err := run(t, ep, "w "+name); err != nil {
+		t.Fatal(err)
+	}
+	bytes, _ := os.ReadFile(name)
+	eq(t, "indentation retabbed", string(bytes), "a\t        b\n\tx\n")
+	eq(t, "buffer left alone", mainContent(ep), "a\t        b|        x")
+	eq(t, "cursor left alone", ep.main.Where.LineCol, grid.LineCol{Line: 1, Col: 8})
+	undo(ep)
+	eq(t, "writing is not a step", mainContent(ep), "a\tb|        x")
+	screen.TabWidth = 2
+	ep.main.Buffer.ReplaceLines(1, 2, []string{"        y"})
+	run(t, ep, "w")
+	bytes, _ = os.ReadFile(name)
+	eq(t, "retabbed at the buffer's width", string(bytes), "a\tb\n\ty\n")
+	eq(t, "bad setting", run(t, ep, "tabs wide") != nil, true)
+}
+
+func TestFileArgument(t *testing.T) {
+	check := func(arg, name string, where grid.LineCol) {
+		t.Helper()
+		gotName, gotWhere := FileArgument(arg)
+		eq(t, arg+" name", gotName, name)
+		eq(t, arg+" place", gotWhere, where)
+	}
+	check("main.go", "main.go", grid.LineCol{})
+	check("main.go+12", "main.go", grid.LineCol{Line: 11})
+	check("main.go+12:5", "main.go", grid.LineCol{Line: 11, Col: 4})
+	check("c++", "c++", grid.LineCol{})
+	check("a+b+3", "a+b", grid.LineCol{Line: 2})
+}
+
+func TestOpenEditorPanel(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(name, []byte("zero\none\n"), 0666)
+	h, err := OpenEditorPanel(name, grid.LineCol{Line: 1, Col: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep := h.(*EditorPanel)
+	eq(t, "file read", mainContent(ep), "zero|one")
+	eq(t, "cursor placed", ep.main.Where.LineCol, grid.LineCol{Line: 1, Col: 2})
+	eq(t, "reading is not undoable", undo(ep) != nil, true)
+
+	h, err = OpenEditorPanel(name+"-new", grid.LineCol{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep = h.(*EditorPanel)
+	eq(t, "new file is empty", mainContent(ep), "")
+	if err := run(t, ep, "w"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name + "-new"); err != nil {
+		t.Error("new file not written:", err)
+	}
+}
+
+func TestGuardedQuit(t *testing.T) {
+	freshPanels(t)
+	name := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(name, []byte("text\n"), 0666)
+	h, _ := OpenEditorPanel(name, grid.LineCol{})
+	ep := h.(*EditorPanel)
+	quitKey := tcell.NewEventKey(tcell.KeyCtrlX, 0, tcell.ModNone)
+	ep.Key(quitKey)
+	eq(t, "clean buffers quit", Quitting(), true)
+
+	quitting = false
+	ep.Key(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone))
+	eq(t, "q refused", run(t, ep, "q") != nil, true)
+	ep.Key(quitKey)
+	eq(t, "ctrl-X refused", Quitting(), false)
+	eq(t, "refusal shown", strings.HasPrefix(ep.status, "unsaved changes in "+name), true)
+	ep.Key(quitKey)
+	eq(t, "second ctrl-X quits", Quitting(), true)
+
+	quitting = false
+	undo(ep)
+	eq(t, "q after undoing back to the file", run(t, ep, "q"), nil)
+	eq(t, "undone quits", Quitting(), true)
+
+	quitting = false
+	ep.Key(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone))
+	if err := run(t, ep, "w "+name+".copy"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "q refused after writing a copy", run(t, ep, "q") != nil, true)
+	eq(t, "copy does not quit", Quitting(), false)
+	eq(t, "buffer keeps its name", ep.main.Buffer.FileName(), name)
+
+	if err := run(t, ep, "wq"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "wq quits", Quitting(), true)
+	bytes, _ := os.ReadFile(name)
+	eq(t, "wq writes", string(bytes), "xtext\n")
+
+	quitting = false
+	NewEditorPanel().(*EditorPanel).main.Buffer.Insert(grid.LineCol{}, 'y')
+	eq(t, "wq needs names", run(t, ep, "wq") != nil, true)
+	eq(t, "wq refused", Quitting(), false)
+	eq(t, "q! quits anyway", run(t, ep, "q!"), nil)
+	eq(t, "quit", Quitting(), true)
+}
+
+func TestExternalChanges(t *testing.T) {
+	freshPanels(t)
+	freshRegisters(t)
+	told := []bool{}
+	Watch = func(on bool) { told = append(told, on) }
+	defer func() { watching, Watch = false, nil }()
+	name := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(name, []byte("one\ntwo\n"), 0666)
+	h, _ := OpenEditorPanel(name, grid.LineCol{})
+	ep := h.(*EditorPanel)
+	ep.main.Buffer.Insert(grid.LineCol{Line: 1}, 'x')
+	os.WriteFile(name, []byte("one\nthree\n"), 0666)
+
+	CheckFiles()
+	eq(t, "not watching", ep.status, "")
+	run(t, ep, "watch on")
+	CheckFiles()
+	eq(t, "change noticed", ep.status, name+" changed on disk: reload or diff")
+	ep.status = ""
+	CheckFiles()
+	eq(t, "change noticed once", ep.status, "")
+	eq(t, "told of watching", fmt.Sprint(told), "[true]")
+
+	eq(t, "w refuses", run(t, ep, "w") != nil, true)
+	if err := run(t, ep, "diff"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "diff in register", strings.Join(registers['d'], "|"), "@@ -2,1 +2,1 @@|-three|+xtwo")
+	if err := run(t, ep, "reload"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "reloaded", mainContent(ep), "one|three")
+	eq(t, "reloaded buffer is saved", ep.main.Buffer.Modified(), false)
+	undo(ep)
+	eq(t, "reload undone", mainContent(ep), "one|xtwo")
+	os.WriteFile(name, []byte("changed again\n"), 0666)
+	if err := run(t, ep, "w!"); err != nil {
+		t.Fatal(err)
+	}
+	bytes, _ := os.ReadFile(name)
+	eq(t, "w! overwrites", string(bytes), "one\nxtwo\n")
+
+	ep.main.Buffer.Insert(grid.LineCol{}, 'y')
+	if err := run(t, ep, "w "+name+".copy"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "w after writing a copy", run(t, ep, "w"), nil)
+}
+
+func TestReadAndWriteRanges(t *testing.T) {
+	dir := t.TempDir()
+	part := filepath.Join(dir, "part")
+	os.WriteFile(part, []byte("x\ny\n"), 0666)
+	ep := newTestPanel(t, "a", "bc", "d")
+	ep.main.Marked.SetRange(2, 2)
+	ep.main.Where.LineCol = grid.LineCol{Line: 1, Col: 1}
+	if err := run(t, ep, "r "+part); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "spliced at cursor", mainContent(ep), "a|bx|y|c|d")
+	eq(t, "cursor after insertion", ep.main.Where.LineCol, grid.LineCol{Line: 3, Col: 0})
+	first, last := ep.main.Marked.Range()
+	eq(t, "mark moved down", [2]int{first, last}, [2]int{4, 4})
+	eq(t, "file name not taken", ep.main.Buffer.FileName(), "")
+	undo(ep)
+	eq(t, "read undone", mainContent(ep), "a|bc|d")
+
+	ep.main.Marked.SetRange(0, 1)
+	out := filepath.Join(dir, "out")
+	if err := run(t, ep, "wr "+out); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(t, ep, "ar "+out); err != nil {
+		t.Fatal(err)
+	}
+	bytes, _ := os.ReadFile(out)
+	eq(t, "range written then appended", string(bytes), "a\nbc\na\nbc\n")
+
+	if err := run(t, ep, "ri "+part); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "range replaced", mainContent(ep), "x|y|d")
+	first, last = ep.main.Marked.Range()
+	eq(t, "replacement marked", [2]int{first, last}, [2]int{0, 1})
+	ep.main.Marked.Clear()
+	eq(t, "ri needs a range", run(t, ep, "ri "+part) != nil, true)
+	eq(t, "wr needs a range", run(t, ep, "wr "+out) != nil, true)
+}
+
+func TestDirectoryListing(t *testing.T) {
+	freshPanels(t)
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0777)
+	os.WriteFile(filepath.Join(dir, "b-big"), []byte("0123456789\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "a-small"), []byte("s\n"), 0666)
+	os.WriteFile(filepath.Join(dir, ".hidden"), nil, 0666)
+	os.WriteFile(filepath.Join(dir, "sub", "inner"), []byte("inside\n"), 0666)
+	names := func(ep *EditorPanel) string {
+		shown := []string{}
+		for _, info := range ep.listing.entries {
+			shown = append(shown, info.Name())
+		}
+		return strings.Join(shown, " ")
+	}
+	press := func(ep *EditorPanel, k tcell.Key, ch rune) { ep.Key(tcell.NewEventKey(k, ch, tcell.ModNone)) }
+
+	ep := newTestPanel(t, "text")
+	if err := run(t, ep, "ls "+dir); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "text panel kept", mainContent(ep), "text")
+	l := ep.Spawned().(*EditorPanel)
+	eq(t, "spawned once", ep.Spawned() == nil, true)
+	eq(t, "sorted by name", names(l), ".. a-small b-big sub")
+	eq(t, "heading", l.main.Buffer.Line(0), dir+" (by name)")
+	eq(t, "directory marked", strings.HasSuffix(l.main.Buffer.Line(4), " sub/"), true)
+
+	press(l, tcell.KeyRune, 'x')
+	press(l, tcell.KeyDelete, 0)
+	eq(t, "read-only", l.main.Buffer.Line(1), entryLine(l.listing.entries[0]))
+	eq(t, "listing is never unsaved", l.main.Buffer.Modified(), false)
+	press(l, tcell.KeyRune, 's')
+	eq(t, "sorted by size", strings.Index(names(l), "b-big") < strings.Index(names(l), "a-small"), true)
+	press(l, tcell.KeyRune, 'h')
+	eq(t, "hidden shown", strings.Contains(names(l), ".hidden"), true)
+	if err := run(t, l, "ls -S"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "ls in a listing replaces it", l.Spawned() == nil, true)
+	eq(t, "hidden hidden again", strings.Contains(names(l), ".hidden"), false)
+
+	press(l, tcell.KeyRune, 'n')
+	l.main.Where.LineCol = grid.LineCol{Line: 4}
+	press(l, tcell.KeyEnter, 0)
+	eq(t, "descended", names(l), ".. inner")
+	l.main.Where.LineCol = grid.LineCol{Line: 2}
+	press(l, tcell.KeyEnter, 0)
+	eq(t, "file opened", mainContent(l), "inside")
+	eq(t, "listing gone", l.listing == nil, true)
+	eq(t, "buffer knows its file", l.main.Buffer.FileName(), filepath.Join(dir, "sub", "inner"))
+}
+
+func TestBufferRegistry(t *testing.T) {
+	freshPanels(t)
+	dir := t.TempDir()
+	one, two := filepath.Join(dir, "one"), filepath.Join(dir, "two")
+	os.WriteFile(one, []byte("1\n"), 0666)
+	os.WriteFile(two, []byte("2\n"), 0666)
+	left := NewEditorPanel().(*EditorPanel)
+	right := NewEditorPanel().(*EditorPanel)
+
+	if err := run(t, left, "e "+one); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(t, right, "e "+one+"+1:2"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "buffer shared", left.main.Buffer, right.main.Buffer)
+	eq(t, "own cursor", right.main.Where.LineCol, grid.LineCol{Line: 0, Col: 1})
+	left.main.Buffer.Insert(grid.LineCol{}, 'x')
+	eq(t, "edit seen in both", mainContent(right), "x1")
+	if err := run(t, right, "e "+two); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "empty buffers left behind are closed", len(buffers), 2)
+
+	if err := run(t, right, "bl"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "buffer list", right.main.Buffer.Line(0), "  1 * "+one+"  (1 lines)")
+	right.main.Where.LineCol = grid.LineCol{Line: 0}
+	right.Key(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	eq(t, "chosen from list", mainContent(right), "x1")
+	eq(t, "cursor kept for the buffer", right.main.Where.LineCol, grid.LineCol{Line: 0, Col: 2})
+
+	right.main.Marked.SetRange(0, 0)
+	if err := run(t, right, "b two"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "switched by name", mainContent(right), "2")
+	eq(t, "marked range left behind", right.main.Marked.IsActive(), false)
+	if err := run(t, right, "b 1"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "switched by number", mainContent(right), "x1")
+	eq(t, "unknown buffer", run(t, right, "b three") != nil, true)
+
+	lister := NewEditorPanel().(*EditorPanel)
+	if err := run(t, lister, "bl"); err != nil {
+		t.Fatal(err)
+	}
+	lister.main.Where.LineCol = grid.LineCol{Line: 1}
+	eq(t, "bd refuses unsaved", run(t, right, "bd") != nil, true)
+	if err := run(t, right, "bd!"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "buffer closed", len(buffers), 1)
+	eq(t, "left shows another", mainContent(left), "2")
+	eq(t, "right shows another", mainContent(right), "2")
+	eq(t, "list redone", mainContent(lister), "  1   "+two+"  (1 lines)")
+	lister.Key(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	eq(t, "closed buffer not chosen", lister.choices != nil, true)
+	eq(t, "nothing unsaved", len(unsaved()), 0)
+}
+
+func TestSessionState(t *testing.T) {
+	freshPanels(t)
+	dir := t.TempDir()
+	name := filepath.Join(dir, "f")
+	os.WriteFile(name, []byte("a\nb\nc\n"), 0666)
+	h, _ := OpenEditorPanel(name, grid.LineCol{Line: 1, Col: 1})
+	ep := h.(*EditorPanel)
+	ep.main.Marked.SetRange(1, 2)
+	ep.main.Offset = grid.Offset{Vertical: 1}
+	saved := ep.SessionState()
+	eq(t, "saved", saved, PanelState{File: name, Where: grid.LineCol{Line: 1, Col: 1}, Offset: grid.Offset{Vertical: 1}, First: 1, Last: 2})
+
+	freshPanels(t)
+	os.WriteFile(name, []byte("a\nb\n"), 0666)
+	ep = restored(saved)
+	eq(t, "file restored", mainContent(ep), "a|b")
+	eq(t, "cursor restored", ep.main.Where.LineCol, grid.LineCol{Line: 1, Col: 1})
+	eq(t, "offset restored", ep.main.Offset, grid.Offset{Vertical: 1})
+	first, last := ep.main.Marked.Range()
+	eq(t, "range restored within the file", [2]int{first, last}, [2]int{1, 1})
+	beyond := saved
+	beyond.Where = grid.LineCol{Line: 9, Col: 4}
+	eq(t, "cursor restored within the file", restored(beyond).main.Where.LineCol, grid.LineCol{Line: 2})
+
+	run(t, ep, "ls "+dir)
+	listed := restored(ep.Spawned().(*EditorPanel).SessionState())
+	eq(t, "listing restored", listed.listing.dir, dir)
+	eq(t, "unnamed buffer restored empty", mainContent(restored(PanelState{First: -1, Last: -1})), "")
+
+	gone := restored(PanelState{File: dir, First: -1, Last: -1})
+	eq(t, "unreadable file restored empty", mainContent(gone), "")
+	eq(t, "unreadable file reported", strings.HasPrefix(gone.status, "not restored: "), true)
+	gone = restored(PanelState{Directory: filepath.Join(dir, "gone"), First: -1, Last: -1})
+	eq(t, "missing directory restored empty", gone.listing == nil && mainContent(gone) == "", true)
+}
+
+// restored restores a panel from s.
+func restored(s PanelState) *EditorPanel {
+	return RestoreEditorPanel(s).(*EditorPanel)
+}
+
+func TestConfig(t *testing.T) {
+	freshPanels(t)
+	savedWidth := screen.TabWidth
+	t.Cleanup(func() { resetConfig(); screen.TabWidth = savedWidth })
+	name := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(name, []byte(`{
+		"tabs": {"width": 8, "expand": true},
+		"gutter": 8,
+		"layout": "stack",
+		"colours": {"mark": "green/black", "numbers": "mauve", "nose": "red"},
+		"keys": {
+			"main": {"F5": ":tabs", "Ctrl-Q": "quit", "Hyper-X": "quit", "F6": "fly"},
+			"layout": {"Ctrl-U": "", "Ctrl-K Ctrl-U": "new-panel"},
+			"nowhere": {}
+		},
+		"extensions": {".go": {"width": 2, "expand": false}, "txt": {}},
+		"fonts": "large"
+	}`), 0666)
+	err := LoadConfig(name, false)
+	problems := []string{
+		name + `: colours: nose: not a style`,
+		name + `: colours: numbers: "mauve" is not a colour`,
+		name + `: extensions: txt: extensions start with a dot`,
+		name + `: unknown setting "fonts"`,
+		name + `: keys: layout: Ctrl-K Ctrl-U: layout keys cannot be chords`,
+		name + `: keys: main: F6: "fly" is not an action; Hyper-X: "Hyper-X" is not a key`,
+		name + `: keys: nowhere: not a key context`,
+	}
+	if err == nil {
+		t.Fatal("bad entries not reported")
+	}
+	eq(t, "bad entries reported", err.Error(), strings.Join(problems, "\n"))
+	eq(t, "tabs", tabs, tabSettings{width: 8, expand: true})
+	eq(t, "gutter", tryTagSize, 8)
+	eq(t, "layout", ConfigLayout(), "stack")
+	eq(t, "mark colour", markStyle, screen.DefaultStyle.Foreground(tcell.ColorGreen).Background(tcell.ColorBlack))
+	eq(t, "numbers left alone", numberStyle, defaults.styles["numbers"])
+	eq(t, "layout key unbound", layouts.Keys.Bindings()["Ctrl-U"], "")
+
+	ep := newTestPanel(t, "x")
+	ep.Key(tcell.NewEventKey(tcell.KeyF5, 0, tcell.ModNone))
+	eq(t, "bound key runs command", ep.status, "tabs 8 expand keep")
+	run(t, ep, "w "+filepath.Join(filepath.Dir(name), "f.go"))
+	ep.Key(tcell.NewEventKey(tcell.KeyF5, 0, tcell.ModNone))
+	eq(t, "extension overrides", ep.status, "tabs 2 insert keep")
+	eq(t, "tab width in use", screen.TabWidth, 2)
+
+	os.WriteFile(name, []byte(`{"gutter": 7}`), 0666)
+	if err := run(t, ep, "config"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "reloaded", tryTagSize, 7)
+	eq(t, "others back to defaults", tabs, defaults.tabs)
+	eq(t, "keys forgotten", len(keymaps["main"].Bindings()), 1)
+	eq(t, "layout keys back", layouts.Keys.Bindings()["Ctrl-U"], layouts.AddPanel)
+	os.WriteFile(name, []byte(`{"gutter": 9,`), 0666)
+	eq(t, "broken file refused", run(t, ep, "config") != nil, true)
+	eq(t, "settings kept", tryTagSize, 7)
+	eq(t, "missing file", run(t, ep, "config "+name+".missing") != nil, true)
+}
+
+func TestKeymaps(t *testing.T) {
+	freshPanels(t)
+	t.Cleanup(resetKeys)
+	ctrlX := tcell.NewEventKey(tcell.KeyCtrlX, 0, tcell.ModCtrl)
+	rune := func(ch rune) *tcell.EventKey { return tcell.NewEventKey(tcell.KeyRune, ch, tcell.ModNone) }
+	ep := newTestPanel(t, "x")
+	ep.main.Where.LineCol = grid.LineCol{}
+
+	if err := bindKey("main", "Ctrl-X Ctrl-S", "mark-first"); err != nil {
+		t.Fatal(err)
+	}
+	ep.Key(ctrlX)
+	eq(t, "chord begun", ep.status, "Ctrl-X -")
+	eq(t, "prefix does nothing alone", quitting, false)
+	ep.Key(tcell.NewEventKey(tcell.KeyCtrlS, 0, tcell.ModCtrl))
+	eq(t, "chord runs action", ep.main.Marked.IsActive(), true)
+	bindKey("main", "F7", ":tabs 3")
+	ep.Key(tcell.NewEventKey(tcell.KeyF7, 0, tcell.ModNone))
+	eq(t, "key runs command", ep.status, "tabs 3 insert keep")
+	tabs = defaults.tabs
+	ep.Key(ctrlX)
+	ep.Key(rune('q'))
+	eq(t, "unfinished chord", ep.status, "Ctrl-X q is not bound")
+	eq(t, "not typed", mainContent(ep), "x")
+
+	ep.Key(tcell.NewEventKey(tcell.KeyF9, 0, tcell.ModNone))
+	eq(t, "unbound key", ep.status, "F9 is not bound")
+	ep.Key(tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModAlt))
+	eq(t, "unbound alt rune", ep.status, "Alt-a is not bound")
+	eq(t, "nothing inserted", mainContent(ep), "x")
+	ep.Key(rune('a'))
+	eq(t, "runes type themselves", mainContent(ep), "ax")
+
+	bindKey("command", "Ctrl-Z", "")
+	run(t, ep, "describe Ctrl-Z")
+	eq(t, "describe named key", ep.message, "Ctrl-Z runs undo in global")
+	run(t, ep, "describe Ctrl-X")
+	eq(t, "describe prefix", ep.message, "Ctrl-X begins a chord in main")
+	run(t, ep, "describe a")
+	eq(t, "describe rune", ep.message, "a types itself")
+	run(t, ep, "describe")
+	ep.current = &ep.command
+	ep.Key(tcell.NewEventKey(tcell.KeyCtrlZ, 0, tcell.ModCtrl))
+	eq(t, "describe next key in context", ep.status, "Ctrl-Z is not bound")
+	eq(t, "described, not done", mainContent(ep), "ax")
+	ep.Key(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	eq(t, "context keymap", ep.current == &ep.main, true)
+}
+
+func TestTokens(t *testing.T) {
+	cases := []struct{ line, words, err string }{
+		{"", "", ""},
+		{"  r   a.txt  ", "r|a.txt", ""},
+		{`w "my file.txt"`, "w|my file.txt", ""},
+		{`w 'it''s'`, "w|its", ""},
+		{`w "say \"hi\""`, `w|say "hi"`, ""},
+		{`w 'back\slash'`, `w|back\slash`, ""},
+		{`w my\ file`, "w|my file", ""},
+		{`w ''`, "w|", ""},
+		{`w "open`, "", `missing closing "`},
+		{`w end\`, "", `nothing after \`},
+	}
+	for _, c := range cases {
+		words, err := tokens(c.line)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%q: got error %v, expected %v", c.line, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.line, err)
+			continue
+		}
+		eq(t, c.line, strings.Join(words, "|"), c.words)
+	}
+}
+
+func TestCommandLines(t *testing.T) {
+	freshPanels(t)
+	for name := range commands {
+		if _, ok := usages[name]; !ok {
+			t.Errorf("no usage for %v", name)
+		}
+	}
+	dir := t.TempDir()
+	ep := newTestPanel(t, "one", "two")
+	ep.main.Where.LineCol = grid.LineCol{}
+
+	eq(t, "missing argument", run(t, ep, "r").Error(), "usage: r file")
+	eq(t, "too many arguments", run(t, ep, "q now").Error(), "usage: q")
+	eq(t, "bad quoting", run(t, ep, `r "x`).Error(), `missing closing "`)
+	eq(t, "not a command", run(t, ep, "frobnicate hard").Error(), "not a command: frobnicate")
+	eq(t, "empty line", run(t, ep, "   ").Error(), "no command")
+
+	name := filepath.Join(dir, "my file.txt")
+	if err := run(t, ep, `  w  "`+name+`"  `); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "quoted name with spaces", ep.main.Buffer.FileName(), name)
+	if err := run(t, ep, `r  '`+name+`'`); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "read back", mainContent(ep), "one|two|one|two")
+
+	if err := run(t, ep, "  s/one/uno/"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "character command after blanks", lineOf(ep.main.Buffer, 2), "uno")
+	eq(t, "word must end at a blank", commandWord("sr/x/"), "")
+	eq(t, "word with bang", commandWord("bd! x"), "bd!")
+}
+
+// shape describes a parsed script for comparison.
+func shape(n node) string {
+	switch n := n.(type) {
+	case commandNode:
+		return "[" + string(n) + "]"
+	case sequenceNode:
+		parts := []string{}
+		for _, m := range n {
+			parts = append(parts, shape(m))
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	case ifNode:
+		otherwise := "-"
+		if n.otherwise != nil {
+			otherwise = shape(n.otherwise)
+		}
+		return "if(" + shape(n.cond) + "," + shape(n.then) + "," + otherwise + ")"
+	case whileNode:
+		return "while(" + shape(n.cond) + "," + shape(n.body) + ")"
+	}
+	return "?"
+}
+
+func TestScriptGrammar(t *testing.T) {
+	cases := []struct{ script, shape string }{
+		{"w x", "[w x]"},
+		{" a ;; b ; ", "{[a] [b]}"},
+		{"if /x/ then d else w y fi", "if([/x/],[d],[w y])"},
+		{"if a then b fi; c", "{if([a],[b],-) [c]}"},
+		{"while search foo do s/foo/bar/ done", "while([search foo],[s/foo/bar/])"},
+		{"(a; b); c", "{{[a] [b]} [c]}"},
+		{"while a do if b then c else (d; e) fi done", "while([a],if([b],[c],{[d] [e]}))"},
+		{"if (a; b) then c fi", "if({[a] [b]},[c],-)"},
+		{"s/(x)/y/", "[s/(x)/y/]"},
+		{`w "a;b done"; s/a\;b/c/`, `{[w "a;b done"] [s/a;b/c/]}`},
+		{`w a\;b`, `[w a\;b]`},
+		{"w done", "[w done]"},
+		{`while a do w "done" done`, `while([a],[w "done"])`},
+		{"s/;/-/", "[s/;/-/]"},
+		{"s;a;b;g; w x", "{[s;a;b;g] [w x]}"},
+		{"/a;b/; ?c;d?", "{[/a;b/] [?c;d?]}"},
+		{"/x y/,/;/s/a/b/ ; d", "{[/x y/,/;/s/a/b/] [d]}"},
+		{`1,2w "a;b"; d`, `{[1,2w "a;b"] [d]}`},
+		{"if /x then/ then d fi", "if([/x then/],[d],-)"},
+		{"s/a;b", "[s/a;b]"},
+		{"search a; d", "{[search a] [d]}"},
+	}
+	for _, c := range cases {
+		n, err := parseScript(c.script)
+		if err != nil {
+			t.Errorf("%q: %v", c.script, err)
+			continue
+		}
+		eq(t, c.script, shape(n), c.shape)
+	}
+	errors := []struct{ script, err string }{
+		{"", "no command"},
+		{" ; ", "no command"},
+		{"if a fi", "if without then"},
+		{"if a then b", "if without fi"},
+		{"while a do b", "do without done"},
+		{"while a done", "while without do"},
+		{"while a do w done done", "unexpected done"},
+		{"(a", "missing )"},
+		{"fi", "unexpected fi"},
+		{"if then a fi", "nothing after if"},
+		{"while a do done", "nothing after do"},
+	}
+	for _, c := range errors {
+		_, err := parseScript(c.script)
+		if err == nil {
+			t.Errorf("%q: no error, expected %v", c.script, c.err)
+			continue
+		}
+		eq(t, c.script, err.Error(), c.err)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	freshPanels(t)
+	ep := newTestPanel(t, "foo one", "two", "foo three foo")
+	if err := run(t, ep, "mark 1; while search foo do s/foo/bar/ done"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "loop replaces each", mainContent(ep), "bar one|two|bar three bar")
+	eq(t, "one undo step", undo(ep), nil)
+	eq(t, "undone together", mainContent(ep), "foo one|two|foo three foo")
+
+	run(t, ep, "if search zzz then mark 1 else mark 2 fi")
+	first, _ := ep.main.Marked.Range()
+	eq(t, "else part", first, 1)
+	run(t, ep, "if search three then mark 1 3 fi")
+	first, last := ep.main.Marked.Range()
+	eq(t, "then part", last-first, 2)
+
+	eq(t, "sequence stops at failure", run(t, ep, "mark 9; mark 2").Error(), "no line 9")
+	first, _ = ep.main.Marked.Range()
+	eq(t, "later commands not run", first, 0)
+
+	saved := loopLimit
+	loopLimit = 5
+	t.Cleanup(func() { loopLimit = saved })
+	eq(t, "loop limit", run(t, ep, "while search two do mark 1 done").Error(), "while stopped after 5 passes")
+
+	ep.main.Where.LineCol = grid.LineCol{Line: 1}
+	ep.main.Buffer.ReplaceLines(1, 2, []string{"a;b"})
+	if err := run(t, ep, "s/;/-/"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "; in a pattern", ep.main.Buffer.Line(1), "a-b")
+}
+
+func TestAddresses(t *testing.T) {
+	freshPanels(t)
+	freshRegisters(t)
+	ep := newTestPanel(t, "package x", "func a() {", "\tone", "}", "func b() {", "\ttwo", "}")
+	ep.main.Marked.SetRange(1, 3)
+	run(t, ep, "sr a")
+	ep.main.Marked.Clear()
+	ep.main.Where.LineCol = grid.LineCol{Line: 2}
+	cases := []struct {
+		line        string
+		first, last int
+		rest        string
+	}{
+		{".", 2, 2, ""},
+		{"$", 6, 6, ""},
+		{"3", 2, 2, ""},
+		{"2,4d", 1, 3, "d"},
+		{".,$mr", 2, 6, "mr"},
+		{"+2", 4, 4, ""},
+		{"-1,+1", 1, 3, ""},
+		{"/^func/ d", 4, 4, " d"},
+		{"/^func/,/^}/w out.go", 4, 6, "w out.go"},
+		{"?^func?,.", 1, 2, ""},
+		{"%p a", 0, 6, "p a"},
+		{",d", 0, 6, "d"},
+		{"$-1", 5, 5, ""},
+		{"'a", 1, 3, ""},
+		{"'a,$", 1, 6, ""},
+		{".,'a", 2, 3, ""},
+		{"'a+1", 2, 4, ""},
+	}
+	for _, c := range cases {
+		first, last, rest, found, err := ep.address(c.line)
+		if err != nil || !found {
+			t.Errorf("%q: found %v, error %v", c.line, found, err)
+			continue
+		}
+		eq(t, c.line, fmt.Sprint(first, last, rest), fmt.Sprint(c.first, c.last, c.rest))
+	}
+	for _, line := range []string{"/foo/", "/foo/r", "s/a/b/", "w x", ""} {
+		if _, _, _, found, _ := ep.address(line); found {
+			t.Errorf("%q taken as an address", line)
+		}
+	}
+	bad := []struct{ line, err string }{
+		{"9", "no line 9"},
+		{"4,2d", "addresses out of order"},
+		{"/zzz/ d", "no line matches zzz"},
+		{"'q", "no range q"},
+		{"1,x", "not an address: x"},
+		{"1,", "expected an address after ,"},
+		{".,", "expected an address after ,"},
+		{"/func/,", "expected an address after ,"},
+	}
+	for _, c := range bad {
+		_, _, _, _, err := ep.address(c.line)
+		if err == nil {
+			t.Errorf("%q: no error, expected %v", c.line, c.err)
+			continue
+		}
+		eq(t, c.line, err.Error(), c.err)
+	}
+
+	name := filepath.Join(t.TempDir(), "out.go")
+	if err := run(t, ep, "/^func b/,/^}/w "+name); err != nil {
+		t.Fatal(err)
+	}
+	written, _ := os.ReadFile(name)
+	eq(t, "addressed write", string(written), "func b() {\n\ttwo\n}\n")
+	eq(t, "file name kept", ep.main.Buffer.FileName(), "")
+	if err := run(t, ep, "5,6s/^/#/"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "addressed substitute", mainContent(ep), "package x|func a() {|\tone|}|#func b() {|#\ttwo|}")
+	if err := run(t, ep, "$r "+name); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "addressed read", ep.main.Buffer.LineCount(), 10)
+	if err := run(t, ep, "2,4d"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "addressed delete", mainContent(ep), "package x|#func b() {|#\ttwo|}|func b() {|\ttwo|}")
+	ep.main.Marked.SetRange(4, 5)
+	ep.main.Where.LineCol = grid.LineCol{Line: 3}
+	if err := run(t, ep, ".,$w "+name); err != nil {
+		t.Fatal(err)
+	}
+	first, last := ep.main.Marked.Range()
+	eq(t, "marked range kept", fmt.Sprint(first, last), "4 5")
+	if err := run(t, ep, "1,2d"); err != nil {
+		t.Fatal(err)
+	}
+	first, last = ep.main.Marked.Range()
+	eq(t, "marked range follows the edit", fmt.Sprint(first, last), "2 3")
+	ep.main.Marked.Clear()
+	if err := run(t, ep, "3"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "bare address moves", ep.main.Where.Line, 2)
+	eq(t, "and does not mark", ep.main.Marked.IsActive(), false)
+	if err := run(t, ep, "d"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "unaddressed d deletes cursor line", ep.main.Buffer.LineCount(), 4)
+	ep.main.Where.LineCol = grid.LineCol{Line: 2}
+	eq(t, "cursor line inside the range", run(t, ep, ".,$mr").Error(), "range overlaps target")
+	if err := run(t, ep, ".,$mr 0"); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "addressed move", mainContent(ep), "\ttwo|}|#\ttwo|}")
+}
+
+// typeCommand types s into a new command line and runs it.
+func typeCommand(ep *EditorPanel, s string) {
+	ep.Key(tcell.NewEventKey(tcell.KeyF1, 0, tcell.ModNone))
+	for _, ch := range s {
+		ep.Key(tcell.NewEventKey(tcell.KeyRune, ch, tcell.ModNone))
+	}
+	ep.Key(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+}
+
+func TestHistory(t *testing.T) {
+	freshPanels(t)
+	saved := history
+	history = nil
+	t.Cleanup(func() { history = saved })
+	key := func(ep *EditorPanel, k tcell.Key) { ep.Key(tcell.NewEventKey(k, 0, tcell.ModNone)) }
+
+	one := newTestPanel(t, "a", "b", "c")
+	typeCommand(one, "mark 1")
+	typeCommand(one, "mark 2")
+	typeCommand(one, "  mark 1 ")
+	eq(t, "remembered once each", strings.Join(history, "|"), "mark 2|mark 1")
+
+	two := newTestPanel(t, "x")
+	key(two, tcell.KeyF1)
+	for _, ch := range "draft" {
+		two.Key(tcell.NewEventKey(tcell.KeyRune, ch, tcell.ModNone))
+	}
+	key(two, tcell.KeyUp)
+	eq(t, "shared between panels", two.commandLine(), "mark 1")
+	key(two, tcell.KeyUp)
+	eq(t, "older", two.commandLine(), "mark 2")
+	key(two, tcell.KeyUp)
+	eq(t, "no older", two.status, "no older command")
+	key(two, tcell.KeyDown)
+	key(two, tcell.KeyDown)
+	eq(t, "back to draft", two.commandLine(), "draft")
+
+	key(two, tcell.KeyCtrlR)
+	two.Key(tcell.NewEventKey(tcell.KeyRune, '2', tcell.ModNone))
+	eq(t, "incremental search", two.commandLine(), "mark 2")
+	two.Key(tcell.NewEventKey(tcell.KeyRune, '9', tcell.ModNone))
+	eq(t, "failing search", strings.HasPrefix(two.status, "failing"), true)
+	key(two, tcell.KeyEscape)
+	eq(t, "search cancelled", two.commandLine(), "draft")
+
+	key(one, tcell.KeyF1)
+	key(one, tcell.KeyCtrlR)
+	one.Key(tcell.NewEventKey(tcell.KeyRune, 'm', tcell.ModNone))
+	eq(t, "newest match first", one.commandLine(), "mark 1")
+	key(one, tcell.KeyCtrlR)
+	eq(t, "older match", one.commandLine(), "mark 2")
+	key(one, tcell.KeyEnter)
+	first, _ := one.main.Marked.Range()
+	eq(t, "enter runs match", first, 1)
+	eq(t, "run moves to newest", strings.Join(history, "|"), "mark 1|mark 2")
+
+	savedBackups := text.Backups
+	text.Backups = text.NumberedBackup
+	t.Cleanup(func() { text.Backups = savedBackups })
+	name := filepath.Join(t.TempDir(), "termboxed", "history")
+	for i := 0; i < 2; i += 1 {
+		if err := SaveHistory(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(name))
+	eq(t, "history not backed up", len(entries), 1)
+	history = nil
+	if err := LoadHistory(name); err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "persisted", strings.Join(history, "|"), "mark 1|mark 2")
+	eq(t, "missing file", LoadHistory(name+".missing"), nil)
+}
+
+func TestCompletion(t *testing.T) {
+	freshPanels(t)
+	freshRegisters(t)
+	dir := t.TempDir()
+	for _, name := range []string{"alpha.txt", "alpine.go", "my file", ".hidden"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0666)
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0777)
+	ep := newTestPanel(t, "a")
+	tab := tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone)
+	start := func(s string) {
+		ep.Key(tcell.NewEventKey(tcell.KeyF1, 0, tcell.ModNone))
+		for _, ch := range s {
+			ep.Key(tcell.NewEventKey(tcell.KeyRune, ch, tcell.ModNone))
+		}
+	}
+
+	start("wat")
+	ep.Key(tab)
+	eq(t, "command name", ep.commandLine(), "watch ")
+	ep.Key(tcell.NewEventKey(tcell.KeyRune, 'o', tcell.ModNone))
+	ep.Key(tab)
+	eq(t, "alternatives listed", ep.status, "2 completions: off on")
+	ep.Key(tab)
+	eq(t, "first alternative", ep.commandLine(), "watch off")
+	ep.Key(tab)
+	eq(t, "cycles", ep.commandLine(), "watch on")
+	eq(t, "shown one marked", ep.status, "2 completions: off [on]")
+
+	start("r " + dir + "/al")
+	ep.Key(tab)
+	eq(t, "shared part filled in", ep.commandLine(), "r "+dir+"/alp")
+	eq(t, "files listed", ep.status, "2 completions: "+dir+"/alpha.txt "+dir+"/alpine.go")
+	start("r " + dir + "/m")
+	ep.Key(tab)
+	eq(t, "blanks escaped", ep.commandLine(), "r "+dir+`/my\ file `)
+	ep.Key(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	eq(t, "completed name works", ep.main.Buffer.LineCount(), 2)
+	start("ls " + dir + "/")
+	ep.Key(tab)
+	eq(t, "directories only", ep.commandLine(), "ls "+dir+"/sub/")
+	start("ls -a -")
+	ep.Key(tab)
+	eq(t, "options", ep.status, "3 completions: -S -a -t")
+	start("1,$w " + dir + "/.h")
+	ep.Key(tab)
+	eq(t, "after an address, hidden asked for", ep.commandLine(), "1,$w "+dir+"/.hidden ")
+
+	start("tabs w")
+	ep.Key(tab)
+	eq(t, "placeholders left out", ep.status, "no completions")
+	start("tabs 8 e")
+	ep.Key(tab)
+	eq(t, "words in the usage", ep.commandLine(), "tabs 8 expand ")
+	if _, err := openBuffer(filepath.Join(dir, "alpine.go")); err != nil {
+		t.Fatal(err)
+	}
+	start("b alp")
+	ep.Key(tab)
+	eq(t, "buffer by last element", ep.commandLine(), "b alpine.go ")
+
+	registers['q'], registers['r'] = []string{"x"}, []string{"y"}
+	start("mark 1; p ")
+	ep.Key(tab)
+	eq(t, "registers in a script", ep.status, "2 completions: q r")
+	start("zz")
+	ep.Key(tab)
+	eq(t, "nothing to complete", ep.status, "no completions")
+	start("1,")
+	ep.Key(tab)
+	eq(t, "unfinished address", ep.status, "no completions")
+}
@@ -0,0 +1,247 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/events"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// FileArgument splits a command-line argument "name+line:col" into
+// the file name and the place to start editing it. Lines and columns
+// count from 1; ":col" or the whole suffix may be left off. An
+// argument whose suffix is not numbers is taken to be all name.
+func FileArgument(arg string) (string, grid.LineCol) {
+	plus := strings.LastIndexByte(arg, '+')
+	if plus < 0 {
+		return arg, grid.LineCol{}
+	}
+	numbers := strings.SplitN(arg[plus+1:], ":", 2)
+	place := []int{1, 1}
+	for i, number := range numbers {
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return arg, grid.LineCol{}
+		}
+		place[i] = n
+	}
+	return arg[:plus], grid.LineCol{Line: bounds.Max(place[0]-1, 0), Col: bounds.Max(place[1]-1, 0)}
+}
+
+// OpenEditorPanel returns an EditorPanel on the named file with its
+// cursor at where. If the file does not exist the panel starts empty
+// and writes to that name.
+func OpenEditorPanel(fileName string, where grid.LineCol) (events.Handler, error) {
+	j, err := openBuffer(fileName)
+	if err != nil {
+		return nil, err
+	}
+	ep := newEditorPanel(j)
+	ep.main.Where.LineCol = where
+	return ep, nil
+}
+
+// openFile returns a new main buffer holding the named file, or an
+// empty one that writes to that name if there is no such file.
+func openFile(fileName string) (text.Buffer, error) {
+	b := newMainBuffer()
+	f, err := os.Open(fileName)
+	switch {
+	case err == nil:
+		defer f.Close()
+		_, err = b.ReadFromFile(grid.LineCol{}, fileName, f)
+	case os.IsNotExist(err):
+		_, err = b.ReadFromFile(grid.LineCol{}, fileName, strings.NewReader(""))
+	}
+	return b, err
+}
+
+// readFile runs "r name", which splices the named file into the main
+// buffer at the cursor, or after the addressed lines, and leaves the
+// cursor after it.
+func readFile(ep *EditorPanel, blobs []string) error {
+	if ep.addressed {
+		_, last := ep.main.Marked.Range()
+		ep.main.Where.LineCol = grid.LineCol{Line: last + 1}
+	}
+	f, err := os.Open(blobs[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	end, err := ep.main.Buffer.ReadFromFile(ep.main.Where.LineCol, blobs[1], f)
+	ep.main.Where.LineCol = end
+	return err
+}
+
+// readOverRange runs "ri name", which replaces the lines of the
+// marked range with those of the named file and marks them instead.
+func readOverRange(ep *EditorPanel, blobs []string) error {
+	if !ep.main.Marked.IsActive() {
+		return errors.New("no marked range")
+	}
+	f, err := os.Open(blobs[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lines, err := text.ReadLines(f)
+	if err != nil {
+		return err
+	}
+	first, last := ep.main.Marked.Range()
+	ep.main.Buffer.ReplaceLines(first, bounds.Min(last+1, ep.main.Buffer.LineCount()), lines)
+	if len(lines) == 0 {
+		ep.main.Marked.Clear()
+	} else {
+		ep.main.Marked.SetRange(first, first+len(lines)-1)
+	}
+	ep.main.Where.LineCol = grid.LineCol{Line: first}
+	return nil
+}
+
+// writeRange runs "wr name", which writes the lines of the marked
+// range to the named file, and "ar name", which appends them to it.
+// Neither changes which file the buffer belongs to.
+func writeRange(ep *EditorPanel, blobs []string) error {
+	lines, err := markedLines(ep)
+	if err != nil {
+		return err
+	}
+	if blobs[0] == "ar" {
+		err = text.AppendLinesToFile(blobs[1], lines)
+	} else {
+		err = text.WriteLinesToFile(blobs[1], lines)
+	}
+	if err == nil {
+		ep.inform(fmt.Sprintf("%v lines written to %v", len(lines), blobs[1]))
+	}
+	return err
+}
+
+// watching is set when panels should be told of changes made to
+// their files by other programs as they happen.
+var watching bool
+
+// Watch, if set, is told when watching is turned on or off, so that
+// CheckFiles need only be called while it is on.
+var Watch func(on bool)
+
+// writeFile runs "w [name]", which writes the main buffer to the
+// named file or to the file it came from. If that file has changed on
+// disk since it was read, w refuses and "w!" is needed. Given an
+// address, it writes the addressed lines as wr does.
+func writeFile(ep *EditorPanel, blobs []string) error {
+	if ep.addressed {
+		if len(blobs) < 2 {
+			return errors.New("usage: first,last w file")
+		}
+		return writeRange(ep, []string{"wr", blobs[1]})
+	}
+	return write(ep.main.Buffer, blobs[1:], blobs[0] == "w!")
+}
+
+// write writes b to the file named, if any, retabbed if the tabs
+// settings say so. Unless force is set it will not write over its own
+// file if that has changed on disk.
+func write(b text.Buffer, name []string, force bool) error {
+	if !force && (len(name) == 0 || name[0] == b.FileName()) {
+		if _, changed, _ := text.ChangedOnDisk(b); changed {
+			return fmt.Errorf("%v changed on disk; w! overwrites it, reload rereads it, diff compares", b.FileName())
+		}
+	}
+	return b.WriteToFile(name)
+}
+
+// reload replaces the main buffer with its file as it is now; the
+// replacement can be undone.
+func reload(ep *EditorPanel, blobs []string) error {
+	b := ep.main.Buffer
+	if b.FileName() == "" {
+		return errors.New("no file name")
+	}
+	f, err := os.Open(b.FileName())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	where := ep.main.Where.LineCol
+	if n := b.LineCount(); n > 0 {
+		b.DeleteLines(where, 0, n-1)
+	}
+	if _, err := b.ReadFromFile(grid.LineCol{}, b.FileName(), f); err != nil {
+		return err
+	}
+	ep.main.Where.LineCol = where
+	ep.noticed = b.FileStamp()
+	return nil
+}
+
+// diffFile runs "diff [register]", which puts the differences between
+// the main buffer's file on disk and the buffer into a register, d
+// unless another is named, ready to be pasted.
+func diffFile(ep *EditorPanel, blobs []string) error {
+	name := 'd'
+	if len(blobs) > 1 {
+		var err error
+		if name, err = nameArgument(blobs, 1); err != nil {
+			return err
+		}
+	}
+	b := ep.main.Buffer
+	if b.FileName() == "" {
+		return errors.New("no file name")
+	}
+	content, err := os.ReadFile(b.FileName())
+	if err != nil {
+		return err
+	}
+	disk := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		disk = nil
+	}
+	diff := text.Diff(disk, b.Expose())
+	if len(diff) == 0 {
+		ep.inform("no differences")
+		return nil
+	}
+	registers[name] = diff
+	ep.inform(fmt.Sprintf("%v lines of diff; p %c pastes them", len(diff), name))
+	return nil
+}
+
+// watch runs "watch on" or "watch off", turning on or off the checking
+// of open files for changes made by other programs.
+func watch(ep *EditorPanel, blobs []string) error {
+	if blobs[1] != "on" && blobs[1] != "off" {
+		return errors.New("usage: " + usages["watch"])
+	}
+	watching = blobs[1] == "on"
+	if Watch != nil {
+		Watch(watching)
+	}
+	return nil
+}
+
+// CheckFiles tells each panel, once, if its file has been changed by
+// another program, when watching is on. It is meant to be called
+// every so often from the event loop.
+func CheckFiles() {
+	if !watching {
+		return
+	}
+	for _, ep := range panels {
+		b := ep.main.Buffer
+		now, changed, _ := text.ChangedOnDisk(b)
+		if changed && now != ep.noticed {
+			ep.noticed = now
+			ep.status = b.FileName() + " changed on disk: reload or diff"
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+	"github.com/gdamore/tcell"
+)
+
+// history holds the command lines run in any panel, oldest first,
+// each only once.
+var history []string
+
+// historyLimit is how many command lines history keeps.
+var historyLimit = 500
+
+// remember adds line to the end of the history, dropping any earlier
+// copy of it and the oldest lines if there are too many.
+func remember(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	kept := history[:0]
+	for _, h := range history {
+		if h != line {
+			kept = append(kept, h)
+		}
+	}
+	history = append(kept, line)
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+	}
+}
+
+// HistoryFile returns the name of the file the command history is
+// kept in between sessions, or "" if there is nowhere to keep it.
+func HistoryFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "termboxed", "history")
+}
+
+// LoadHistory reads the command history from the named file, one
+// command line a line. A missing file is an empty history.
+func LoadHistory(fileName string) error {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lines, err := text.ReadLines(f)
+	if err != nil {
+		return err
+	}
+	history = nil
+	for _, line := range lines {
+		remember(line)
+	}
+	return nil
+}
+
+// SaveHistory writes the command history to the named file, making
+// its directory if need be. No backup is made of the file.
+func SaveHistory(fileName string) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return err
+	}
+	return text.WriteLinesWithoutBackup(fileName, history)
+}
+
+// commandLine returns the command line the command cursor is on.
+func (ep *EditorPanel) commandLine() string {
+	return lineOf(ep.command.Buffer, ep.command.Where.Line)
+}
+
+// setCommandLine replaces the command line the command cursor is on
+// with s, leaving the cursor at its end.
+func (ep *EditorPanel) setCommandLine(s string) {
+	b := ep.command.Buffer
+	line := ep.command.Where.Line
+	if line < b.LineCount() {
+		b.ReplaceLines(line, line+1, []string{s})
+	} else {
+		b.ReplaceLines(b.LineCount(), b.LineCount(), []string{s})
+	}
+	ep.command.Where.LineCol = grid.LineCol{Line: line, Col: text.RuneCount(s)}
+}
+
+// recallOlder shows the history line before the one shown, keeping
+// the line as typed to come back to.
+func (ep *EditorPanel) recallOlder() {
+	if ep.recall == len(history) {
+		ep.status = "no older command"
+		return
+	}
+	if ep.recall == 0 {
+		ep.draft = ep.commandLine()
+	}
+	ep.recall += 1
+	ep.setCommandLine(history[len(history)-ep.recall])
+}
+
+// recallNewer shows the history line after the one shown, or the line
+// as typed after the newest.
+func (ep *EditorPanel) recallNewer() {
+	switch {
+	case ep.recall == 0:
+		ep.status = "no newer command"
+	case ep.recall == 1:
+		ep.recall = 0
+		ep.setCommandLine(ep.draft)
+	default:
+		ep.recall -= 1
+		ep.setCommandLine(history[len(history)-ep.recall])
+	}
+}
+
+// historySearch is an incremental search back through the history.
+type historySearch struct {
+	query string
+	at    int    // the index in history of the line shown, or len(history)
+	draft string // the command line before the search began
+}
+
+// startHistorySearch begins an incremental search back through the
+// history from the command line.
+func (ep *EditorPanel) startHistorySearch() {
+	ep.hunt = &historySearch{at: len(history), draft: ep.commandLine()}
+	ep.showHunt(true)
+}
+
+// huntFrom shows the newest history line containing the query at or
+// before index from, reporting whether there is one.
+func (ep *EditorPanel) huntFrom(from int) bool {
+	h := ep.hunt
+	for i := from; i >= 0; i -= 1 {
+		if i < len(history) && strings.Contains(history[i], h.query) {
+			h.at = i
+			ep.setCommandLine(history[i])
+			return true
+		}
+	}
+	return false
+}
+
+// showHunt puts the state of the history search in the status bar.
+func (ep *EditorPanel) showHunt(found bool) {
+	failing := ""
+	if !found {
+		failing = "failing "
+	}
+	ep.status = fmt.Sprintf("%vhistory search %q (ctrl-R older, enter runs, esc cancels)", failing, ep.hunt.query)
+}
+
+// huntKey handles a key pressed during a history search. Runes extend
+// the query and backspace shortens it; Ctrl-R looks for an older
+// match; Enter runs the line found and Escape or Ctrl-G puts back the
+// line as it was. Any other key ends the search, leaving the line
+// found to be edited, and is handled as usual.
+func (ep *EditorPanel) huntKey(e *tcell.EventKey) (handled bool) {
+	h := ep.hunt
+	switch e.Key() {
+	case tcell.KeyRune:
+		h.query += string(e.Rune())
+		ep.showHunt(ep.huntFrom(h.at))
+	case tcell.KeyBackspace2, tcell.KeyBackspace:
+		_, size := utf8.DecodeLastRuneInString(h.query)
+		h.query = h.query[:len(h.query)-size]
+		ep.showHunt(ep.huntFrom(len(history) - 1))
+	case tcell.KeyCtrlR:
+		ep.showHunt(ep.huntFrom(h.at - 1))
+	case tcell.KeyEscape, tcell.KeyCtrlG:
+		ep.hunt = nil
+		ep.setCommandLine(h.draft)
+		ep.status = ""
+	case tcell.KeyEnter:
+		ep.hunt = nil
+		return false
+	default:
+		ep.hunt = nil
+		ep.status = ""
+		return false
+	}
+	return true
+}
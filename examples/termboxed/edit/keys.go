@@ -0,0 +1,328 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/keymap"
+	"github.com/ehedgehog/guineapig/examples/termboxed/layouts"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+	"github.com/gdamore/tcell"
+)
+
+// actions are what keys can be bound to, by name. A key may also be
+// bound to ":" followed by a command line, which it runs.
+var actions = map[string]func(ep *EditorPanel){
+	"undo":         func(ep *EditorPanel) { undo(ep) },
+	"redo":         func(ep *EditorPanel) { redo(ep) },
+	"search-again": func(ep *EditorPanel) { repeatSearch(ep) },
+	"quit": func(ep *EditorPanel) {
+		if ep.quitAsked {
+			forceQuit(ep, nil)
+		} else if err := quit(ep, nil); err != nil {
+			ep.status = err.Error() + "; quit again discards them"
+			ep.quitAsked = true
+		}
+	},
+	"new-command": func(ep *EditorPanel) {
+		ep.current = &ep.command
+		ep.command.Where.LineCol = ep.command.Buffer.Return(ep.command.Where.LineCol)
+		ep.recall = 0
+	},
+	"execute-command": func(ep *EditorPanel) {
+		remember(ep.commandLine())
+		ep.recall = 0
+		ep.command.Where.LineCol, _ = ep.command.Buffer.Execute(ep.command.Where.LineCol)
+	},
+	"switch-focus": func(ep *EditorPanel) {
+		if ep.current == &ep.main {
+			ep.current = &ep.command
+		} else {
+			ep.current = &ep.main
+		}
+	},
+	"insert-tab": func(ep *EditorPanel) { insertTab(ep.current) },
+	"delete-back": func(ep *EditorPanel) {
+		ep.current.Where.LineCol = ep.current.Buffer.DeleteBack(ep.current.Where.LineCol)
+	},
+	"delete-forward": func(ep *EditorPanel) {
+		ep.current.Where.LineCol = ep.current.Buffer.DeleteForward(ep.current.Where.LineCol)
+	},
+	"mark-first": func(ep *EditorPanel) { ep.main.Marked.SetLow(ep.main.Where.Line) },
+	"mark-last":  func(ep *EditorPanel) { ep.main.Marked.SetHigh(ep.main.Where.Line) },
+	"page-up": func(ep *EditorPanel) {
+		where := ep.current.Where.LineCol
+		vo := ep.current.Offset.Vertical
+		if where.Line-vo == 0 {
+			top := bounds.Max(0, where.Line-ep.textBox.Size().Height)
+			ep.current.Where.LineCol = grid.LineCol{top, where.Col}
+		} else {
+			ep.current.Where.LineCol = grid.LineCol{vo, where.Col}
+		}
+	},
+	"page-down": func(ep *EditorPanel) {
+		where := ep.current.Where.LineCol
+		vo := ep.current.Offset.Vertical
+		height := ep.textBox.Size().Height
+		if where.Line-vo == height-1 {
+			// forward one page
+			bot := where.Line + height
+			ep.current.Where.LineCol = grid.LineCol{bot, where.Col}
+		} else {
+			// bottom of this page
+			ep.current.Where.LineCol = grid.LineCol{vo + height - 1, where.Col}
+		}
+	},
+	"line-end": func(ep *EditorPanel) {
+		where := ep.current.Where.LineCol
+		if where.Col == 0 {
+			where.Col = text.RuneCount(lineOf(ep.current.Buffer, where.Line))
+		} else {
+			where.Col = 0
+		}
+		ep.current.Where.LineCol = where
+	},
+	"newline": func(ep *EditorPanel) {
+		ep.current.Where.LineCol = ep.current.Buffer.Return(ep.current.Where.LineCol)
+	},
+	"run-command": func(ep *EditorPanel) {
+		remember(ep.commandLine())
+		ep.recall = 0
+		b := ep.command.Buffer
+		ep.message, ep.status = "OK", ""
+		_, err := b.Execute(ep.command.Where.LineCol)
+		if err == nil {
+			report(ep, b, ep.message)
+		} else {
+			report(ep, b, err.Error())
+		}
+		ep.current = &ep.main
+	},
+	"history-back":    func(ep *EditorPanel) { ep.recallOlder() },
+	"history-forward": func(ep *EditorPanel) { ep.recallNewer() },
+	"history-search":  func(ep *EditorPanel) { ep.startHistorySearch() },
+	"right":           func(ep *EditorPanel) { ep.current.Where.RightOne() },
+	"up":              func(ep *EditorPanel) { ep.current.Where.UpOne() },
+	"down":            func(ep *EditorPanel) { ep.current.Where.DownOne() },
+	"left":            func(ep *EditorPanel) { ep.current.Where.LeftOne() },
+	"open-entry": func(ep *EditorPanel) {
+		if err := ep.openEntry(ep.main.Where.Line - 1); err != nil {
+			ep.status = err.Error()
+		}
+	},
+	"sort-by-name":  func(ep *EditorPanel) { ep.sortListing('n') },
+	"sort-by-size":  func(ep *EditorPanel) { ep.sortListing('s') },
+	"sort-by-time":  func(ep *EditorPanel) { ep.sortListing('t') },
+	"toggle-hidden": func(ep *EditorPanel) { ep.toggleHidden() },
+	"choose-buffer": func(ep *EditorPanel) { ep.chooseBuffer() },
+}
+
+// typing are the actions that, in the main buffer, are undone
+// together when they come one after another; typed runes are too.
+var typing = map[string]bool{"insert-tab": true, "delete-back": true, "delete-forward": true}
+
+// keymaps are the editor's keymaps by context. Keys in the main text,
+// a directory listing or the buffer list fall back on those of main,
+// and keys in main or the command line on global.
+var keymaps = defaultKeymaps()
+
+// defaultBindings are the keymaps before the config file changes
+// them, as context, chord and action.
+var defaultBindings = [][3]string{
+	{"global", "Ctrl-Z", "undo"},
+	{"global", "Ctrl-Y", "redo"},
+	{"global", "Ctrl-N", "search-again"},
+	{"global", "Ctrl-X", "quit"},
+	{"global", "F1", "new-command"},
+	{"global", "F2", "execute-command"},
+	{"global", "Ctrl-B", "switch-focus"},
+	{"global", "Tab", "insert-tab"},
+	{"global", "Backspace2", "delete-back"},
+	{"global", "Delete", "delete-forward"},
+	{"global", "F3", "mark-first"},
+	{"global", "F4", "mark-last"},
+	{"global", "PgUp", "page-up"},
+	{"global", "PgDn", "page-down"},
+	{"global", "End", "line-end"},
+	{"global", "Right", "right"},
+	{"global", "Up", "up"},
+	{"global", "Down", "down"},
+	{"global", "Left", "left"},
+	{"main", "Enter", "newline"},
+	{"command", "Enter", "run-command"},
+	{"command", "Up", "history-back"},
+	{"command", "Down", "history-forward"},
+	{"command", "Ctrl-R", "history-search"},
+	{"command", "Tab", "complete"},
+	{"listing", "Enter", "open-entry"},
+	{"listing", "n", "sort-by-name"},
+	{"listing", "s", "sort-by-size"},
+	{"listing", "t", "sort-by-time"},
+	{"listing", "h", "toggle-hidden"},
+	{"buffers", "Enter", "choose-buffer"},
+}
+
+func defaultKeymaps() map[string]*keymap.Keymap {
+	global := keymap.New("global", nil)
+	main := keymap.New("main", global)
+	k := map[string]*keymap.Keymap{
+		"global":  global,
+		"main":    main,
+		"command": keymap.New("command", global),
+		"listing": keymap.New("listing", main),
+		"buffers": keymap.New("buffers", main),
+	}
+	for _, b := range defaultBindings {
+		c, err := keymap.ParseChord(b[1])
+		if err != nil {
+			panic(err)
+		}
+		k[b[0]].Bind(c, b[2])
+	}
+	return k
+}
+
+// resetKeys puts back the default keymaps, the layout's included.
+func resetKeys() {
+	keymaps = defaultKeymaps()
+	layouts.Keys = layouts.DefaultKeys()
+}
+
+// bindKey binds chord to action in the named context, checking that
+// both make sense. An empty action unbinds the chord.
+func bindKey(context, chord, action string) error {
+	c, err := keymap.ParseChord(chord)
+	if err != nil {
+		return err
+	}
+	if context == "layout" {
+		if len(c) > 1 {
+			return errors.New("layout keys cannot be chords")
+		}
+		if action != "" && action != layouts.AddPanel && action != layouts.AddStack {
+			return fmt.Errorf("%q is not a layout action", action)
+		}
+		layouts.Keys.Bind(c, action)
+		return nil
+	}
+	k := keymaps[context]
+	if k == nil {
+		return fmt.Errorf("%q is not a key context", context)
+	}
+	if _, ok := actions[action]; !ok && action != "" && !strings.HasPrefix(action, ":") {
+		return fmt.Errorf("%q is not an action", action)
+	}
+	k.Bind(c, action)
+	return nil
+}
+
+// keymap returns the keymap for where ep's cursor is.
+func (ep *EditorPanel) keymap() *keymap.Keymap {
+	switch {
+	case ep.current == &ep.command:
+		return keymaps["command"]
+	case ep.listing != nil:
+		return keymaps["listing"]
+	case ep.choices != nil:
+		return keymaps["buffers"]
+	}
+	return keymaps["main"]
+}
+
+// lookupKey adds the stroke of e to any chord already begun and looks
+// the chord up. It returns the action to do, if any, and whether the
+// stroke is a rune to be typed. A chord that is neither bound nor the
+// beginning of a binding is reported and forgotten.
+func (ep *EditorPanel) lookupKey(e *tcell.EventKey) (action string, typed bool) {
+	stroke := keymap.StrokeOf(e)
+	if stroke.Key == KeySpace {
+		stroke = keymap.Stroke{Key: tcell.KeyRune, Rune: ' ', Mod: stroke.Mod}
+	}
+	chord := append(ep.pending, stroke)
+	ep.pending = nil
+	action, from, prefix := ep.keymap().Lookup(chord)
+	switch {
+	case prefix:
+		ep.pending = chord
+		ep.status = chord.String() + " -"
+	case action != "":
+	case from == nil && len(chord) == 1 && stroke.Key == tcell.KeyRune && stroke.Mod&(tcell.ModAlt|tcell.ModMeta|tcell.ModCtrl) == 0:
+		return "", true
+	default:
+		ep.status = chord.String() + " is not bound"
+	}
+	return action, false
+}
+
+// doAction does the named action, which may be a command line.
+func (ep *EditorPanel) doAction(action string) {
+	if strings.HasPrefix(action, ":") {
+		ep.runBound(action[1:])
+		return
+	}
+	if f := actions[action]; f != nil {
+		f(ep)
+	}
+}
+
+// runBound runs the command line bound to a key, showing the outcome
+// in the status bar.
+func (ep *EditorPanel) runBound(command string) {
+	ep.message, ep.status = "OK", ""
+	if err := execute(ep, command); err != nil {
+		ep.status = err.Error()
+	} else if ep.status == "" {
+		ep.status = ep.message
+	}
+}
+
+// describe says what chord does where ep's cursor is.
+func (ep *EditorPanel) describe(chord keymap.Chord) string {
+	action, from, prefix := ep.keymap().Lookup(chord)
+	switch {
+	case prefix:
+		return fmt.Sprintf("%v begins a chord in %v", chord, from.Name)
+	case action != "":
+		return fmt.Sprintf("%v runs %v in %v", chord, action, from.Name)
+	case len(chord) == 1 && chord[0].Key == tcell.KeyRune && chord[0].Mod == 0:
+		return fmt.Sprintf("%v types itself", chord)
+	}
+	return fmt.Sprintf("%v is not bound", chord)
+}
+
+// describeKey runs "describe [keys]", which says what the keys do in
+// the main text, or, with no keys, what the next key pressed does
+// wherever it is pressed.
+func describeKey(ep *EditorPanel, blobs []string) error {
+	if len(blobs) < 2 {
+		ep.describing = true
+		ep.inform("press a key to describe")
+		return nil
+	}
+	chord, err := keymap.ParseChord(strings.Join(blobs[1:], " "))
+	if err != nil {
+		return err
+	}
+	current := ep.current
+	ep.current = &ep.main
+	ep.inform(ep.describe(chord))
+	ep.current = current
+	return nil
+}
+
+// describeNext describes the key e, or the chord it completes, in
+// place of doing what it does.
+func (ep *EditorPanel) describeNext(e *tcell.EventKey) {
+	chord := append(ep.pending, keymap.StrokeOf(e))
+	ep.pending = nil
+	if _, _, prefix := ep.keymap().Lookup(chord); prefix {
+		ep.pending = chord
+		ep.status = chord.String() + " -"
+		return
+	}
+	ep.describing = false
+	ep.status = ep.describe(chord)
+}
@@ -0,0 +1,223 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// listing is a directory shown in a main buffer, one entry a line
+// after a heading line.
+type listing struct {
+	dir     string
+	entries []fs.FileInfo // in the order shown
+	by      byte          // sort by n(ame), s(ize) or t(ime)
+	hidden  bool          // show names starting with a dot
+	content text.Buffer   // the lines shown, written behind the read-only front
+}
+
+// readOnly is a Buffer whose content cannot be changed through it.
+type readOnly struct {
+	text.Buffer
+}
+
+var errReadOnly = errors.New("read-only listing")
+
+func (b readOnly) Insert(where grid.LineCol, ch rune)                         {}
+func (b readOnly) DeleteLine(where grid.LineCol) grid.LineCol                 { return where }
+func (b readOnly) MoveLines(where grid.LineCol, firstLine, lastLine int)      {}
+func (b readOnly) ReplaceLines(low, high int, lines []string)                 {}
+func (b readOnly) DeleteLines(where grid.LineCol, low, high int) grid.LineCol { return where }
+func (b readOnly) DeleteBack(where grid.LineCol) grid.LineCol                 { return where }
+func (b readOnly) DeleteForward(where grid.LineCol) grid.LineCol              { return where }
+func (b readOnly) Return(where grid.LineCol) grid.LineCol                     { return where }
+func (b readOnly) Execute(where grid.LineCol) (grid.LineCol, error)           { return where, errReadOnly }
+func (b readOnly) WriteToFile(fileName []string) error                        { return errReadOnly }
+func (b readOnly) Modified() bool                                             { return false }
+func (b readOnly) ReadFromFile(where grid.LineCol, fileName string, r io.Reader) (grid.LineCol, error) {
+	return where, errReadOnly
+}
+
+// ls is added to the commands here because listDirectory may make a
+// panel, which refers back to the commands.
+func init() {
+	commands["ls"] = listDirectory
+	usages["ls"] = "ls [-a] [-S|-t] [dir]"
+}
+
+// listDirectory runs "ls [-a] [-S|-t] [dir]", which lists dir, or the
+// current directory, sorted by name, or by size with -S or time with
+// -t, and showing hidden files with -a. The listing replaces the main
+// buffer if that is a listing or empty; otherwise it opens in a new
+// panel.
+func listDirectory(ep *EditorPanel, blobs []string) error {
+	l := &listing{dir: ".", by: 'n'}
+	if ep.listing != nil {
+		l.dir = ep.listing.dir
+	}
+	for _, blob := range blobs[1:] {
+		switch blob {
+		case "-a":
+			l.hidden = true
+		case "-S":
+			l.by = 's'
+		case "-t":
+			l.by = 't'
+		default:
+			if strings.HasPrefix(blob, "-") {
+				return errors.New("usage: " + usages["ls"])
+			}
+			l.dir = blob
+		}
+	}
+	if err := l.start(); err != nil {
+		return err
+	}
+	target := ep
+	if b := ep.main.Buffer; ep.listing == nil && (b.LineCount() > 0 || b.FileName() != "") {
+		target = newEditorPanel(text.NewJournal(readOnly{l.content}))
+		ep.spawned = target
+	}
+	target.showListing(l)
+	return nil
+}
+
+// start makes the listing's directory absolute and gives it its
+// first content.
+func (l *listing) start() error {
+	dir, err := filepath.Abs(l.dir)
+	if err != nil {
+		return err
+	}
+	l.dir = dir
+	l.content = text.NewBuffer(func(b text.Buffer, s string) error { return nil }, text.WithRope())
+	return l.refresh()
+}
+
+// showListing makes l the main buffer of ep with the cursor on its
+// first entry.
+func (ep *EditorPanel) showListing(l *listing) {
+	ep.show(text.NewJournal(readOnly{l.content}))
+	ep.listing = l
+	ep.main.Where.LineCol = grid.LineCol{Line: 1}
+}
+
+// refresh reads the directory again and rewrites the listing.
+func (l *listing) refresh() error {
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return err
+	}
+	l.entries = l.entries[:0]
+	for _, d := range dirEntries {
+		if !l.hidden && strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		if info, err := d.Info(); err == nil {
+			l.entries = append(l.entries, info)
+		}
+	}
+	sort.SliceStable(l.entries, func(i, j int) bool {
+		a, b := l.entries[i], l.entries[j]
+		switch {
+		case l.by == 's' && a.Size() != b.Size():
+			return a.Size() > b.Size()
+		case l.by == 't' && !a.ModTime().Equal(b.ModTime()):
+			return a.ModTime().After(b.ModTime())
+		}
+		return a.Name() < b.Name()
+	})
+	if parent := filepath.Dir(l.dir); parent != l.dir {
+		if info, err := os.Stat(parent); err == nil {
+			l.entries = append([]fs.FileInfo{parentInfo{info}}, l.entries...)
+		}
+	}
+	order := map[byte]string{'n': "name", 's': "size", 't': "time"}[l.by]
+	heading := fmt.Sprintf("%v (by %v", l.dir, order)
+	if l.hidden {
+		heading += ", hidden shown"
+	}
+	lines := []string{heading + ")"}
+	for _, info := range l.entries {
+		lines = append(lines, entryLine(info))
+	}
+	l.content.ReplaceLines(0, l.content.LineCount(), lines)
+	return nil
+}
+
+// parentInfo is the directory above a listing, shown as "..".
+type parentInfo struct {
+	fs.FileInfo
+}
+
+func (p parentInfo) Name() string { return ".." }
+
+// entryLine describes a directory entry: its type, size, modification
+// time and name, directories marked with a trailing slash.
+func entryLine(info fs.FileInfo) string {
+	kind, name := "file", info.Name()
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		kind, name = "dir", name+"/"
+	case mode&fs.ModeSymlink != 0:
+		kind = "link"
+	case !mode.IsRegular():
+		kind = "other"
+	}
+	return fmt.Sprintf("%-5v %10v  %v  %v", kind, info.Size(), info.ModTime().Format("2006-01-02 15:04"), name)
+}
+
+// sortListing sorts the listing by n(ame), s(ize) or t(ime).
+func (ep *EditorPanel) sortListing(by byte) {
+	ep.listing.by = by
+	ep.refreshListing()
+}
+
+// toggleHidden shows or hides the listing's hidden files.
+func (ep *EditorPanel) toggleHidden() {
+	ep.listing.hidden = !ep.listing.hidden
+	ep.refreshListing()
+}
+
+// refreshListing rewrites the listing, reporting any error.
+func (ep *EditorPanel) refreshListing() {
+	if err := ep.listing.refresh(); err != nil {
+		ep.status = err.Error()
+	}
+	ep.main.Where.LineCol = grid.LineCol{Line: 1}
+}
+
+// openEntry descends into entry i of the listing if it is a directory
+// and otherwise replaces the listing with the file's buffer, opening
+// it if need be.
+func (ep *EditorPanel) openEntry(i int) error {
+	l := ep.listing
+	if i < 0 || i >= len(l.entries) {
+		return errors.New("not an entry")
+	}
+	path := filepath.Join(l.dir, l.entries[i].Name())
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		old := l.dir
+		l.dir = path
+		if err := l.refresh(); err != nil {
+			l.dir = old
+			return err
+		}
+		ep.main.Where.LineCol = grid.LineCol{Line: 1}
+		return nil
+	}
+	j, err := openBuffer(path)
+	if err != nil {
+		return err
+	}
+	ep.show(j)
+	return nil
+}
@@ -0,0 +1,59 @@
+package edit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// panels are all the EditorPanels made, so that changes to buffers
+// and files can be shown in every panel they concern.
+var panels []*EditorPanel
+
+// quitting is set once a quit has been accepted.
+var quitting bool
+
+// Quitting reports whether the editor has been told to stop.
+func Quitting() bool {
+	return quitting
+}
+
+// unsaved returns the names of the open buffers that have changed
+// since they were read or written.
+func unsaved() []string {
+	names := []string{}
+	for _, j := range unsavedBuffers() {
+		names = append(names, bufferName(j))
+	}
+	return names
+}
+
+// quit stops the editor unless a buffer has unsaved changes.
+func quit(ep *EditorPanel, blobs []string) error {
+	if names := unsaved(); len(names) > 0 {
+		return fmt.Errorf("unsaved changes in %v; wq writes them, q! discards them", strings.Join(names, ", "))
+	}
+	quitting = true
+	return nil
+}
+
+// forceQuit stops the editor, discarding unsaved changes.
+func forceQuit(ep *EditorPanel, blobs []string) error {
+	quitting = true
+	return nil
+}
+
+// writeAllAndQuit writes every buffer with unsaved changes and stops
+// the editor if they could all be written.
+func writeAllAndQuit(ep *EditorPanel, blobs []string) error {
+	failed := []string{}
+	for _, j := range unsavedBuffers() {
+		if err := write(j, nil, false); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("not quitting: %v", strings.Join(failed, "; "))
+	}
+	quitting = true
+	return nil
+}
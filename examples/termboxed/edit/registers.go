@@ -0,0 +1,240 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+	"github.com/gdamore/tcell"
+)
+
+// namedRanges are marked ranges kept under the names a-z alongside
+// each panel's own marked range. They are shared by all panels and
+// each belongs to the buffer it was set in.
+var namedRanges = map[rune]*text.MarkedRange{}
+
+// registers hold lines of text under the names a-z, filled by
+// deleting or copying a marked range and read by pasting.
+var registers = map[rune][]string{}
+
+// nameStyles distinguish named ranges in the left gutter.
+var nameStyles = []tcell.Style{
+	screen.DefaultStyle.Foreground(tcell.ColorGreen),
+	screen.DefaultStyle.Foreground(tcell.ColorBlue),
+	screen.DefaultStyle.Foreground(tcell.ColorFuchsia),
+	screen.DefaultStyle.Foreground(tcell.ColorTeal),
+	screen.DefaultStyle.Foreground(tcell.ColorOlive),
+	screen.DefaultStyle.Foreground(tcell.ColorPurple),
+}
+
+// nameArgument returns the register or range name given by blobs[i].
+func nameArgument(blobs []string, i int) (rune, error) {
+	if i >= len(blobs) {
+		return 0, errors.New("expected a name a-z")
+	}
+	name := blobs[i]
+	if len(name) != 1 || name[0] < 'a' || name[0] > 'z' {
+		return 0, errors.New("not a name a-z: " + name)
+	}
+	return rune(name[0]), nil
+}
+
+// markedLines returns a copy of the lines of the main marked range.
+func markedLines(ep *EditorPanel) ([]string, error) {
+	if !ep.main.Marked.IsActive() {
+		return nil, errors.New("no marked range")
+	}
+	b := ep.main.Buffer
+	first, last := ep.main.Marked.Range()
+	lines := []string{}
+	for line := first; line <= last; line += 1 {
+		lines = append(lines, lineOf(b, line))
+	}
+	return lines, nil
+}
+
+// moveRange runs "mr [line]", which moves the lines of the marked
+// range, or the addressed lines, to follow the cursor line, or the
+// given line counting from 1, 0 being before the first line.
+func moveRange(ep *EditorPanel, blobs []string) error {
+	if !ep.main.Marked.IsActive() {
+		return errors.New("no marked range")
+	}
+	target := ep.main.Where.Line
+	if len(blobs) > 1 {
+		n, err := strconv.Atoi(blobs[1])
+		if err != nil || n < 0 || n > ep.main.Buffer.LineCount() {
+			return errors.New("no line " + blobs[1])
+		}
+		target = n - 1
+	}
+	first, last := ep.main.Marked.Range()
+	if first <= target && target <= last {
+		return errors.New("range overlaps target")
+	}
+	ep.main.Buffer.MoveLines(grid.LineCol{Line: target}, first, last)
+	return nil
+}
+
+// markLines runs "mark [first [last]]", which marks the lines first
+// to last, counting from 1, or the line first alone, or the cursor
+// line, and puts the cursor on the first of them.
+func markLines(ep *EditorPanel, blobs []string) error {
+	lines := []int{ep.main.Where.Line, ep.main.Where.Line}
+	for i, blob := range blobs[1:] {
+		n, err := strconv.Atoi(blob)
+		if err != nil || n < 1 || n > ep.main.Buffer.LineCount() {
+			return errors.New("no line " + blob)
+		}
+		lines[i] = n - 1
+		if i == 0 {
+			lines[1] = n - 1
+		}
+	}
+	if lines[1] < lines[0] {
+		return errors.New("last line before first")
+	}
+	ep.main.Marked.SetRange(lines[0], lines[1])
+	ep.main.Where.LineCol = grid.LineCol{Line: lines[0]}
+	return nil
+}
+
+// setRange names the main marked range, or the cursor line if there
+// is no marked range.
+func setRange(ep *EditorPanel, blobs []string) error {
+	name, err := nameArgument(blobs, 1)
+	if err != nil {
+		return err
+	}
+	first, last := ep.main.Marked.Range()
+	if first < 0 {
+		first, last = ep.main.Where.Line, ep.main.Where.Line
+	}
+	if old := namedRanges[name]; old != nil {
+		old.Clear()
+	}
+	named := text.NewMarkedRange(ep.main.Buffer)
+	named.SetRange(first, last)
+	namedRanges[name] = named
+	return nil
+}
+
+// swapRange exchanges the main marked range with a named range in
+// the same buffer.
+func swapRange(ep *EditorPanel, blobs []string) error {
+	name, err := nameArgument(blobs, 1)
+	if err != nil {
+		return err
+	}
+	named := namedRanges[name]
+	if named == nil {
+		return fmt.Errorf("no range %c", name)
+	}
+	if named.Buffer() != ep.main.Buffer {
+		return fmt.Errorf("range %c is in another buffer", name)
+	}
+	ep.main.Marked, namedRanges[name] = named, ep.main.Marked
+	if !namedRanges[name].IsActive() {
+		delete(namedRanges, name)
+	}
+	return nil
+}
+
+// listRanges reports the named ranges and the sizes of the registers.
+func listRanges(ep *EditorPanel, blobs []string) error {
+	items := []string{}
+	for name, named := range namedRanges {
+		first, last := named.Range()
+		where := "elsewhere"
+		if named.Buffer() == ep.main.Buffer {
+			where = fmt.Sprintf("%v-%v", first, last)
+		}
+		items = append(items, fmt.Sprintf("%c %v", name, where))
+	}
+	for name, lines := range registers {
+		items = append(items, fmt.Sprintf("%c\" %v lines", name, len(lines)))
+	}
+	if len(items) == 0 {
+		return errors.New("no named ranges or registers")
+	}
+	sort.Strings(items)
+	ep.inform(strings.Join(items, ", "))
+	return nil
+}
+
+// deleteRange deletes the main marked range, saving its lines in the
+// register named by blobs[1] if there is one.
+func deleteRange(ep *EditorPanel, blobs []string) error {
+	lines, err := markedLines(ep)
+	if err != nil {
+		return err
+	}
+	if len(blobs) > 1 {
+		name, err := nameArgument(blobs, 1)
+		if err != nil {
+			return err
+		}
+		registers[name] = lines
+	}
+	first, last := ep.main.Marked.Range()
+	ep.main.Where.LineCol = ep.main.Buffer.DeleteLines(ep.main.Where.LineCol, first, last)
+	ep.main.Marked.Clear()
+	return nil
+}
+
+// copyRange saves the lines of the main marked range in a register.
+func copyRange(ep *EditorPanel, blobs []string) error {
+	name, err := nameArgument(blobs, 1)
+	if err != nil {
+		return err
+	}
+	lines, err := markedLines(ep)
+	if err != nil {
+		return err
+	}
+	registers[name] = lines
+	return nil
+}
+
+// paste inserts the lines of a register after the cursor line and
+// marks them.
+func paste(ep *EditorPanel, blobs []string) error {
+	name, err := nameArgument(blobs, 1)
+	if err != nil {
+		return err
+	}
+	lines, ok := registers[name]
+	if !ok {
+		return fmt.Errorf("register %c is empty", name)
+	}
+	b := ep.main.Buffer
+	at := bounds.Min(ep.main.Where.Line+1, b.LineCount())
+	b.ReplaceLines(at, at, lines)
+	ep.main.Marked.SetRange(at, at+len(lines)-1)
+	return nil
+}
+
+// paintNamedRanges shows the named ranges in b in column col of the
+// gutter, each with its name on its first line.
+func paintNamedRanges(c screen.Canvas, b text.Buffer, col, top, height int) {
+	for name, named := range namedRanges {
+		if named.Buffer() != b || !named.IsActive() {
+			continue
+		}
+		style := nameStyles[int(name-'a')%len(nameStyles)]
+		first, last := named.Range()
+		for line := bounds.Max(first, top); line <= last && line < top+height; line += 1 {
+			glyph := '│'
+			if line == first {
+				glyph = name
+			}
+			c.SetCell(grid.LineCol{Line: line - top, Col: col}, glyph, style)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+)
+
+// A command line is a script in a small language built on the
+// commands:
+//
+//	script:  command {; command}
+//	command: if script then script [else script] fi
+//	         while script do script done
+//	         ( script )
+//	         a line for one of the commands
+//
+// A command succeeds unless it returns an error. A script stops at the
+// first command that fails, failing with it, except that a failing
+// condition of if chooses the else part and one of while ends the loop.
+// A line for a command ends at an unquoted ; that is not escaped by a
+// backslash, at a keyword that ends the if or while it is in, or at a
+// ) ending a group when followed by a blank, ; or ) or the end. The
+// patterns of an address, a search and a substitution are part of the
+// line whatever they hold. In the line of a character command \;
+// stands for ;.
+
+// loopLimit is how many times a while loop may go round before it is
+// taken to be stuck and stopped.
+var loopLimit = 1000
+
+// A node is a parsed script or part of one.
+type node interface {
+	run(ep *EditorPanel) error
+}
+
+// commandNode is a line for one of the commands.
+type commandNode string
+
+// sequenceNode runs its nodes one after another.
+type sequenceNode []node
+
+// ifNode runs then if cond succeeds and otherwise, if any, if not.
+type ifNode struct {
+	cond, then, otherwise node
+}
+
+// whileNode runs body for as long as cond succeeds.
+type whileNode struct {
+	cond, body node
+}
+
+func (c commandNode) run(ep *EditorPanel) error {
+	return runCommand(ep, string(c))
+}
+
+func (s sequenceNode) run(ep *EditorPanel) error {
+	for _, n := range s {
+		if err := n.run(ep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n ifNode) run(ep *EditorPanel) error {
+	if n.cond.run(ep) == nil {
+		return n.then.run(ep)
+	}
+	if n.otherwise != nil {
+		return n.otherwise.run(ep)
+	}
+	return nil
+}
+
+func (n whileNode) run(ep *EditorPanel) error {
+	for i := 0; n.cond.run(ep) == nil; i += 1 {
+		if i == loopLimit {
+			return fmt.Errorf("while stopped after %v passes", loopLimit)
+		}
+		if err := n.body.run(ep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseScript parses a command line into the script it holds.
+func parseScript(s string) (node, error) {
+	p := &parser{source: s}
+	n, err := p.sequence(nil)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := n.(sequenceNode); ok && len(s) == 0 {
+		return nil, errors.New("no command")
+	}
+	return n, nil
+}
+
+// parser reads a script from source, starting at at.
+type parser struct {
+	source string
+	at     int
+	depth  int // how many groups are open
+}
+
+// more moves past blanks and reports whether anything follows.
+func (p *parser) more() bool {
+	for p.at < len(p.source) && (p.source[p.at] == ' ' || p.source[p.at] == '\t') {
+		p.at += 1
+	}
+	return p.at < len(p.source)
+}
+
+// word returns the word at p.at, up to a blank, ; or the end.
+func (p *parser) word() string {
+	end := p.at
+	for end < len(p.source) && !strings.ContainsRune(" \t;", rune(p.source[end])) {
+		end += 1
+	}
+	if end == p.at {
+		return p.source[p.at : p.at+1]
+	}
+	return p.source[p.at:end]
+}
+
+// keyword reports whether the word at p.at is k, moving past it if so.
+func (p *parser) keyword(k string) bool {
+	if !p.more() || p.word() != k {
+		return false
+	}
+	p.at += len(k)
+	return true
+}
+
+// endsGroup reports whether a ) at i ends a group.
+func (p *parser) endsGroup(i int) bool {
+	return p.depth > 0 && p.source[i] == ')' && (i+1 == len(p.source) || strings.ContainsRune(" \t;)", rune(p.source[i+1])))
+}
+
+// sequence parses commands separated by ; up to the end, a ) ending a
+// group, or one of the keywords in stops.
+func (p *parser) sequence(stops []string) (node, error) {
+	s := sequenceNode{}
+	for {
+		if p.more() && p.source[p.at] == ';' {
+			p.at += 1
+			continue
+		}
+		if !p.more() || p.endsGroup(p.at) {
+			break
+		}
+		if w := p.word(); member(w, stops) {
+			break
+		}
+		n, err := p.command(stops)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, n)
+	}
+	if len(s) == 1 {
+		return s[0], nil
+	}
+	return s, nil
+}
+
+// command parses one command, which may be a compound one.
+func (p *parser) command(stops []string) (node, error) {
+	switch w := p.word(); {
+	case w == "if":
+		p.at += len(w)
+		return p.ifCommand()
+	case w == "while":
+		p.at += len(w)
+		return p.whileCommand()
+	case p.source[p.at] == '(':
+		p.at += 1
+		p.depth += 1
+		n, err := p.sequence(nil)
+		if err != nil {
+			return nil, err
+		}
+		if !p.more() || p.source[p.at] != ')' {
+			return nil, errors.New("missing )")
+		}
+		p.at += 1
+		p.depth -= 1
+		return n, nil
+	case member(w, []string{"then", "else", "fi", "do", "done"}) || w == ")":
+		return nil, fmt.Errorf("unexpected %v", w)
+	}
+	return p.line(stops), nil
+}
+
+func (p *parser) ifCommand() (node, error) {
+	cond, err := p.part("if", "then", nil)
+	if err != nil {
+		return nil, err
+	}
+	n := ifNode{cond: cond}
+	if n.then, err = p.part("then", "", []string{"else", "fi"}); err != nil {
+		return nil, err
+	}
+	if p.keyword("else") {
+		if n.otherwise, err = p.part("else", "fi", nil); err != nil {
+			return nil, err
+		}
+	} else if !p.keyword("fi") {
+		return nil, errors.New("if without fi")
+	}
+	return n, nil
+}
+
+func (p *parser) whileCommand() (node, error) {
+	cond, err := p.part("while", "do", nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.part("do", "done", nil)
+	if err != nil {
+		return nil, err
+	}
+	return whileNode{cond: cond, body: body}, nil
+}
+
+// part parses the script following the keyword after, which must not
+// be empty, up to the keyword end, which it moves past, or, if end is
+// "", to one of stops, which it leaves.
+func (p *parser) part(after, end string, stops []string) (node, error) {
+	if end != "" {
+		stops = []string{end}
+	}
+	n, err := p.sequence(stops)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := n.(sequenceNode); ok && len(s) == 0 {
+		return nil, fmt.Errorf("nothing after %v", after)
+	}
+	if end != "" && !p.keyword(end) {
+		return nil, fmt.Errorf("%v without %v", after, end)
+	}
+	return n, nil
+}
+
+// line reads the line for one of the commands, up to where it ends. In
+// the line of a word command quotes are honoured as tokens honours
+// them; the line of a character command is taken as it is, as it may
+// hold quotes of its own.
+func (p *parser) line(stops []string) node {
+	start := p.at
+	p.at += delimited(p.source[start:])
+	quoting := commandWord(strings.TrimLeft(p.source[p.at:], " \t")) != ""
+	var quote byte
+	for p.at < len(p.source) {
+		ch := p.source[p.at]
+		switch {
+		case ch == '\\' && quote != '\'':
+			p.at += 1
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case quoting && (ch == '\'' || ch == '"'):
+			quote = ch
+		case ch == ';' || p.endsGroup(p.at):
+			return lineNode(p.source[start:p.at], quoting)
+		case ch == ' ' || ch == '\t':
+			here := p.at
+			if p.more() && member(p.word(), stops) {
+				return lineNode(p.source[start:here], quoting)
+			}
+			continue
+		}
+		p.at += 1
+	}
+	p.at = len(p.source)
+	return lineNode(p.source[start:], quoting)
+}
+
+// delimited returns how much of the start of line is taken up by
+// patterns between delimiters: those of an address, of a search, and
+// of a substitution after them. A pattern left unclosed takes up the
+// rest of the line.
+func delimited(line string) int {
+	i := 0
+	for i < len(line) {
+		switch ch := line[i]; {
+		case ch == '/' || ch == '?':
+			end := closingDelimiter(line[i+1:], ch)
+			if end < 0 {
+				return len(line)
+			}
+			i += end + 2
+		case ch == '\'':
+			i = bounds.Min(i+2, len(line))
+		case strings.IndexByte(".$+-%,", ch) >= 0 || '0' <= ch && ch <= '9':
+			i += 1
+		default:
+			if ch != 's' || i+1 >= len(line) || commandWord(line[i:]) != "" {
+				return i
+			}
+			delim := line[i+1]
+			i += 2
+			for part := 0; part < 2; part += 1 {
+				end := closingDelimiter(line[i:], delim)
+				if end < 0 {
+					return len(line)
+				}
+				i += end + 1
+			}
+			return i
+		}
+	}
+	return i
+}
+
+// lineNode returns the command node for line, unescaping any \; in it
+// unless it is the line of a word command, which tokens unescapes.
+func lineNode(line string, word bool) node {
+	line = strings.TrimSpace(line)
+	if !word {
+		line = strings.ReplaceAll(line, `\;`, ";")
+	}
+	return commandNode(line)
+}
+
+// member reports whether s is one of list.
+func member(s string, list []string) bool {
+	for _, l := range list {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// charCommands are commands named by their first character rather
+// than by a word. They are given the whole command line, and are only
+// tried when the first word of the line is not one of the commands.
+var charCommands = map[byte]func(*EditorPanel, string) error{
+	'/': search,
+	'?': search,
+	's': substitute,
+}
+
+// searching is a search as typed, kept so that it can be repeated.
+type searching struct {
+	text.Search
+	source   string // the pattern as typed
+	inMarked bool   // search only the marked range
+}
+
+// search runs a search command. "/pattern/flags" searches forward and
+// "?pattern?flags" backward; the closing delimiter may be left off
+// if there are no flags, and may appear in the pattern escaped by a
+// backslash. The pattern is literal unless the flags include r (a Go
+// regular expression). Other flags are i (ignore case), m (search only
+// the marked range) and n (do not wrap around). An empty pattern
+// repeats the previous search in the given direction.
+func search(ep *EditorPanel, command string) error {
+	backward := command[0] == '?'
+	pattern, flags := splitDelimited(command[1:], command[0])
+	if pattern == "" {
+		if ep.lastSearch == nil {
+			return errors.New("no previous search")
+		}
+		ep.lastSearch.Backward = backward
+		return repeatSearch(ep)
+	}
+	s := &searching{source: pattern, Search: text.Search{Backward: backward, Wrap: true}}
+	literal, fold := true, false
+	for _, flag := range flags {
+		switch flag {
+		case 'r':
+			literal = false
+		case 'i':
+			fold = true
+		case 'm':
+			s.inMarked = true
+		case 'n':
+			s.Wrap = false
+		default:
+			return fmt.Errorf("unknown search flag %c", flag)
+		}
+	}
+	re, err := compilePattern(pattern, literal, fold)
+	if err != nil {
+		return err
+	}
+	s.Pattern = re
+	ep.lastSearch = s
+	return repeatSearch(ep)
+}
+
+// compilePattern compiles a search pattern, quoting it if it is
+// literal and making it ignore case if fold is set.
+func compilePattern(pattern string, literal, fold bool) (*regexp.Regexp, error) {
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if fold {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// splitDelimited splits s at the first unescaped delim, returning the
+// part before it with escaped delimiters unescaped, and the rest.
+func splitDelimited(s string, delim byte) (before, after string) {
+	var b strings.Builder
+	for i := 0; i < len(s); i += 1 {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			b.WriteByte(delim)
+			i += 1
+		case s[i] == delim:
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// repeatSearch runs the last search again from the main cursor,
+// moving the cursor to the match found.
+func repeatSearch(ep *EditorPanel) error {
+	s := ep.lastSearch
+	if s == nil {
+		return errors.New("no previous search")
+	}
+	b := ep.main.Buffer
+	low, high := 0, b.LineCount()
+	if s.inMarked {
+		if !ep.main.Marked.IsActive() {
+			return errors.New("no marked range")
+		}
+		first, last := ep.main.Marked.Range()
+		low, high = first, last+1
+	}
+	where, wrapped, found := s.Find(b, ep.main.Where.LineCol, low, high)
+	if !found {
+		return errors.New("not found: " + s.source)
+	}
+	ep.main.Where.LineCol = where
+	ep.adjustScrolling(&ep.main)
+	if wrapped {
+		ep.inform("search wrapped")
+	}
+	return nil
+}
+
+// findPattern runs "search pattern [flags]", the word form of
+// /pattern/flags, so that a pattern may be quoted as any argument is.
+func findPattern(ep *EditorPanel, blobs []string) error {
+	flags := ""
+	if len(blobs) > 2 {
+		flags = blobs[2]
+	}
+	return search(ep, "/"+strings.ReplaceAll(blobs[1], "/", `\/`)+"/"+flags)
+}
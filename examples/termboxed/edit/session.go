@@ -0,0 +1,94 @@
+package edit
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/events"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// PanelState is what a saved session keeps of an EditorPanel.
+type PanelState struct {
+	File      string       `json:"file,omitempty"`
+	Directory string       `json:"directory,omitempty"` // for a listing, in place of File
+	Where     grid.LineCol `json:"where"`
+	Offset    grid.Offset  `json:"offset"`
+	First     int          `json:"first"` // the marked range, or -1, -1 if there is none
+	Last      int          `json:"last"`
+}
+
+// SaveSession, if set, writes the session to the named file, or to
+// the session file the editor was started with if the name is empty.
+var SaveSession func(fileName string) error
+
+// SessionState returns the state of ep to be saved in a session.
+func (ep *EditorPanel) SessionState() PanelState {
+	first, last := ep.main.Marked.Range()
+	s := PanelState{Where: ep.main.Where.LineCol, Offset: ep.main.Offset, First: first, Last: last}
+	switch {
+	case ep.listing != nil:
+		s.Directory = ep.listing.dir
+	case ep.choices == nil && ep.main.Buffer.FileName() != "":
+		s.File, _ = filepath.Abs(ep.main.Buffer.FileName())
+	}
+	return s
+}
+
+// RestoreEditorPanel returns an EditorPanel in the saved state s. A
+// panel whose buffer had no file starts empty, as does one whose file
+// or directory cannot be read, which is reported with Warn.
+func RestoreEditorPanel(s PanelState) events.Handler {
+	var ep *EditorPanel
+	switch {
+	case s.Directory != "":
+		l := &listing{dir: s.Directory, by: 'n'}
+		if err := l.start(); err != nil {
+			return restoreFailed(err)
+		}
+		ep = newEditorPanel(text.NewJournal(readOnly{l.content}))
+		ep.showListing(l)
+	case s.File != "":
+		j, err := openBuffer(s.File)
+		if err != nil {
+			return restoreFailed(err)
+		}
+		ep = newEditorPanel(j)
+	default:
+		ep = NewEditorPanel().(*EditorPanel)
+	}
+	ep.main.Where.LineCol = within(ep.main.Buffer, s.Where)
+	ep.main.Offset = s.Offset
+	if n := ep.main.Buffer.LineCount(); s.First >= 0 && s.First < n {
+		ep.main.Marked.SetRange(s.First, bounds.Min(s.Last, n-1))
+	}
+	return ep
+}
+
+// restoreFailed returns an empty panel in place of one that could not
+// be restored, warning why.
+func restoreFailed(err error) events.Handler {
+	ep := NewEditorPanel()
+	Warn("not restored: " + err.Error())
+	return ep
+}
+
+// saveSession runs "session [file]", which saves the layout and the
+// state of every panel so that the editor can be started again as it
+// is now.
+func saveSession(ep *EditorPanel, blobs []string) error {
+	if SaveSession == nil {
+		return errors.New("sessions cannot be saved here")
+	}
+	name := ""
+	if len(blobs) > 1 {
+		name = blobs[1]
+	}
+	if err := SaveSession(name); err != nil {
+		return err
+	}
+	ep.inform("session saved")
+	return nil
+}
@@ -0,0 +1,234 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+	"github.com/gdamore/tcell"
+)
+
+// substitution is a parsed substitute command.
+type substitution struct {
+	pattern  *regexp.Regexp
+	template string // replacement in regexp.Expand form
+	global   bool   // replace every match in a line, not just the first
+}
+
+// confirming is a substitution waiting for the user to accept or
+// reject each match in turn.
+type confirming struct {
+	substitution
+	next  grid.LineCol // matches at or after next are still to come
+	high  int          // lines before high are to be searched
+	count int
+}
+
+// substitute runs "s/pattern/replacement/flags". The pattern is a Go
+// regular expression and the replacement may refer to its groups
+// as \1 to \9, or to the whole match as &. Any character may be used
+// in place of the slashes. Flags are g (replace every match in a
+// line), i (ignore case), c (confirm each replacement), m (act on the
+// marked range) and a (act on the whole buffer); without m or a only
+// the cursor line, or the addressed lines, are changed.
+func substitute(ep *EditorPanel, command string) error {
+	if len(command) < 2 {
+		return errors.New("usage: s/pattern/replacement/flags")
+	}
+	delim := command[1]
+	pattern, rest := splitDelimited(command[2:], delim)
+	replacement, flags := splitDelimited(rest, delim)
+	s := substitution{template: expandable(replacement)}
+	fold, confirm := false, false
+	b := ep.main.Buffer
+	low, high := ep.main.Where.Line, ep.main.Where.Line+1
+	if ep.addressed {
+		first, last := ep.main.Marked.Range()
+		low, high = first, last+1
+	}
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			s.global = true
+		case 'i':
+			fold = true
+		case 'c':
+			confirm = true
+		case 'm':
+			if !ep.main.Marked.IsActive() {
+				return errors.New("no marked range")
+			}
+			first, last := ep.main.Marked.Range()
+			low, high = first, last+1
+		case 'a':
+			low, high = 0, b.LineCount()
+		default:
+			return fmt.Errorf("unknown substitute flag %c", flag)
+		}
+	}
+	re, err := compilePattern(pattern, false, fold)
+	if err != nil {
+		return err
+	}
+	s.pattern = re
+	if confirm {
+		ep.confirm = &confirming{substitution: s, next: grid.LineCol{Line: low, Col: 0}, high: high}
+		ep.confirmNext()
+		return nil
+	}
+	count := 0
+	for line := low; line < high && line < b.LineCount(); line += 1 {
+		content := b.Line(line)
+		changed, n := s.replace(content, 0)
+		if n > 0 {
+			b.ReplaceLines(line, line+1, []string{changed})
+			count += n
+		}
+	}
+	ep.status = replacements(count)
+	ep.inform(ep.status)
+	return nil
+}
+
+// replacements describes how many replacements were made.
+func replacements(count int) string {
+	if count == 1 {
+		return "1 replacement"
+	}
+	return fmt.Sprintf("%v replacements", count)
+}
+
+// expandable converts an ed-style replacement, with \1 for groups and
+// & for the match, into the form used by regexp.Expand.
+func expandable(replacement string) string {
+	var b strings.Builder
+	for i := 0; i < len(replacement); i += 1 {
+		ch := replacement[i]
+		switch {
+		case ch == '\\' && i+1 < len(replacement):
+			i += 1
+			next := replacement[i]
+			if '0' <= next && next <= '9' {
+				fmt.Fprintf(&b, "${%c}", next)
+			} else if next == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(next)
+			}
+		case ch == '&':
+			b.WriteString("${0}")
+		case ch == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// replace replaces the first match in line at or after byte offset
+// from, or every such match if the substitution is global. It returns
+// the new line and the number of replacements made.
+func (s *substitution) replace(line string, from int) (string, int) {
+	var result []byte
+	count, done := 0, from
+	for _, m := range s.pattern.FindAllStringSubmatchIndex(line, -1) {
+		if m[0] < from {
+			continue
+		}
+		result = append(result, line[done:m[0]]...)
+		result = s.pattern.ExpandString(result, s.template, line, m)
+		done = m[1]
+		count += 1
+		if !s.global {
+			break
+		}
+	}
+	if count == 0 {
+		return line, 0
+	}
+	return line[:from] + string(result) + line[done:], count
+}
+
+// confirmNext moves the main cursor to the next match still to be
+// confirmed, or ends confirmation if there are none.
+func (ep *EditorPanel) confirmNext() {
+	c := ep.confirm
+	search := text.Search{Pattern: c.pattern}
+	where, _, found := search.Find(ep.main.Buffer, c.next.ColMinus(1), c.next.Line, c.high)
+	if !found {
+		ep.confirm = nil
+		ep.status = replacements(c.count)
+		return
+	}
+	ep.main.Where.LineCol = where
+	ep.adjustScrolling(&ep.main)
+	ep.status = "replace? y(es) n(o) a(ll) q(uit)"
+}
+
+// confirmKey handles a key pressed while a substitution is waiting
+// for confirmation.
+func (ep *EditorPanel) confirmKey(e *tcell.EventKey) {
+	c := ep.confirm
+	b := ep.main.Buffer
+	where := ep.main.Where.LineCol
+	c.next = where
+	line := b.Line(where.Line)
+	at := text.ByteOffset(line, where.Col)
+	replaceHere := func() {
+		one := c.substitution
+		one.global = false
+		changed, _ := one.replace(line, at)
+		b.ReplaceLines(where.Line, where.Line+1, []string{changed})
+		c.count += 1
+		c.advance(line, changed, at)
+	}
+	switch {
+	case e.Key() == tcell.KeyRune && e.Rune() == 'y':
+		replaceHere()
+	case e.Key() == tcell.KeyRune && e.Rune() == 'n':
+		c.advance(line, line, at)
+	case e.Key() == tcell.KeyRune && e.Rune() == 'a':
+		replaceHere()
+		for c.next.Line < c.high && c.next.Line < b.LineCount() {
+			content := b.Line(c.next.Line)
+			from := text.ByteOffset(content, c.next.Col)
+			changed, n := c.replace(content, from)
+			if n > 0 {
+				b.ReplaceLines(c.next.Line, c.next.Line+1, []string{changed})
+				c.count += n
+			}
+			c.next = grid.LineCol{Line: c.next.Line + 1}
+		}
+	case e.Key() == tcell.KeyRune && e.Rune() == 'q', e.Key() == tcell.KeyEscape:
+		c.high = c.next.Line
+	default:
+		return
+	}
+	ep.confirmNext()
+}
+
+// advance moves past the match at byte offset at, which has been
+// replaced to turn line into changed, to where the next match may be.
+func (c *confirming) advance(line, changed string, at int) {
+	if !c.global {
+		c.next = grid.LineCol{Line: c.next.Line + 1}
+		return
+	}
+	matched := at
+	for _, m := range c.pattern.FindAllStringIndex(line, -1) {
+		if m[0] >= at {
+			matched = m[1]
+			break
+		}
+	}
+	end := matched + len(changed) - len(line)
+	if matched == at {
+		end += 1
+	}
+	c.next.Col = text.RuneCount(changed[:bounds.Min(end, len(changed))])
+}
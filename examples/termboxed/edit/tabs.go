@@ -0,0 +1,109 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// tabSettings say how the editor treats tabs.
+type tabSettings struct {
+	width  int  // cells between tab stops
+	expand bool // the tab key inserts spaces to the next tab stop
+	retab  bool // indentation is rewritten with tabs when writing
+}
+
+// tabs are the tab settings for files that the config file does not
+// give settings of their own.
+var tabs = tabSettings{width: 4}
+
+// tabsFor returns the tab settings for b, which depend on the
+// extension of its file name.
+func tabsFor(b text.Buffer) tabSettings {
+	return tabsForFile(b.FileName())
+}
+
+// tabsForFile returns the tab settings for the named file.
+func tabsForFile(fileName string) tabSettings {
+	t := tabs
+	if o, ok := config.extensions[filepath.Ext(fileName)]; ok {
+		o.applyTo(&t)
+	}
+	return t
+}
+
+// Lines are retabbed as they are written rather than in the buffer,
+// which keeps the indentation as it was typed.
+func init() {
+	text.WriteConversion = retabLine
+}
+
+// useSettings makes the settings for ep's main buffer the ones that
+// painting and editing use.
+func (ep *EditorPanel) useSettings() {
+	screen.TabWidth = tabsFor(ep.main.Buffer).width
+}
+
+// setTabs runs "tabs" with any of: a width for the tab stops; expand
+// or insert, for what the tab key types; retab or keep, for what
+// writing does to indentation. It changes the settings for files that
+// the config file does not cover, and reports those that apply to the
+// main buffer.
+func setTabs(ep *EditorPanel, blobs []string) error {
+	for _, blob := range blobs[1:] {
+		switch blob {
+		case "expand":
+			tabs.expand = true
+		case "insert":
+			tabs.expand = false
+		case "retab":
+			tabs.retab = true
+		case "keep":
+			tabs.retab = false
+		default:
+			width, err := strconv.Atoi(blob)
+			if err != nil || width < 1 {
+				return errors.New("not a tab setting: " + blob)
+			}
+			tabs.width = width
+		}
+	}
+	ep.useSettings()
+	t := tabsFor(ep.main.Buffer)
+	typing, writing := "insert", "keep"
+	if t.expand {
+		typing = "expand"
+	}
+	if t.retab {
+		writing = "retab"
+	}
+	ep.inform(fmt.Sprintf("tabs %v %v %v", t.width, typing, writing))
+	return nil
+}
+
+// insertTab types a tab at the cursor of s, or the spaces that reach
+// the next tab stop if tabs are being expanded.
+func insertTab(s *State) {
+	if !tabsFor(s.Buffer).expand {
+		s.Buffer.Insert(s.Where.LineCol, '\t')
+		return
+	}
+	cells := text.DisplayColumn(lineOf(s.Buffer, s.Where.Line), s.Where.Col)
+	for n := screen.RuneWidth('\t', cells); n > 0; n -= 1 {
+		s.Buffer.Insert(s.Where.LineCol, ' ')
+	}
+}
+
+// retabLine returns line as it is to be written to the named file:
+// with its indentation rewritten with tabs if the file's tab settings
+// say so.
+func retabLine(fileName, line string) string {
+	if t := tabsForFile(fileName); t.retab {
+		return text.Retab(line, t.width)
+	}
+	return line
+}
@@ -13,3 +13,10 @@ type Handler interface {
 	Geometry() grid.Geometry
 	New() Handler
 }
+
+// A Spawner is a Handler that may ask for a new handler to be put
+// beside it, as when a command opens something in a panel of its own.
+// Spawned returns that handler, once, or nil if there is none.
+type Spawner interface {
+	Spawned() Handler
+}
@@ -7,7 +7,9 @@ type Geometry struct {
 	MaxHeight int
 }
 
-// LineCol is a location on a canvas or like surface.
+// LineCol is a location on a canvas or like surface. In a text
+// buffer Col counts runes, not bytes or display cells; the text
+// package converts between them.
 type LineCol struct {
 	Line int
 	Col  int
@@ -0,0 +1,195 @@
+// Package keymap maps keys, and chords of several keys, to the names
+// of actions. Keymaps are layered: a keymap for a particular context
+// falls back on its parent for keys it does not bind itself.
+package keymap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+)
+
+// A Stroke is one key as pressed: a special key, or a rune if Key is
+// tcell.KeyRune, with the modifiers held down.
+type Stroke struct {
+	Key  tcell.Key
+	Rune rune
+	Mod  tcell.ModMask
+}
+
+// StrokeOf returns the stroke of a key event. Control keys such as
+// Ctrl-A come the same whether or not the event reports ModCtrl, and
+// shifted runes are just the runes they type.
+func StrokeOf(e *tcell.EventKey) Stroke {
+	s := Stroke{Key: e.Key(), Mod: e.Modifiers()}
+	if s.Key == tcell.KeyRune {
+		s.Rune = e.Rune()
+		s.Mod &^= tcell.ModShift
+	}
+	if strings.HasPrefix(tcell.KeyNames[s.Key], "Ctrl-") {
+		s.Mod &^= tcell.ModCtrl
+	}
+	return s
+}
+
+var modifiers = []struct {
+	mod  tcell.ModMask
+	name string
+}{
+	{tcell.ModAlt, "Alt-"},
+	{tcell.ModMeta, "Meta-"},
+	{tcell.ModShift, "Shift-"},
+	{tcell.ModCtrl, "Ctrl-"},
+}
+
+// String names s as ParseStroke reads it, such as F5, Ctrl-X, Alt-x
+// or Space.
+func (s Stroke) String() string {
+	var b strings.Builder
+	for _, m := range modifiers {
+		if s.Mod&m.mod != 0 {
+			b.WriteString(m.name)
+		}
+	}
+	switch {
+	case s.Key == tcell.KeyRune && s.Rune == ' ':
+		b.WriteString("Space")
+	case s.Key == tcell.KeyRune:
+		b.WriteRune(s.Rune)
+	case tcell.KeyNames[s.Key] != "":
+		b.WriteString(tcell.KeyNames[s.Key])
+	default:
+		fmt.Fprintf(&b, "Key%d", s.Key)
+	}
+	return b.String()
+}
+
+// ParseStroke reads a stroke written as String writes it. Key names
+// are not case sensitive.
+func ParseStroke(name string) (Stroke, error) {
+	s := Stroke{}
+	rest := name
+	for {
+		if key, ok := keyNamed(rest); ok {
+			s.Key = key
+			return s, nil
+		}
+		stripped := false
+		for _, m := range modifiers {
+			if len(rest) > len(m.name) && strings.EqualFold(rest[:len(m.name)], m.name) {
+				s.Mod |= m.mod
+				rest = rest[len(m.name):]
+				stripped = true
+				break
+			}
+		}
+		if !stripped {
+			break
+		}
+	}
+	s.Key = tcell.KeyRune
+	switch {
+	case strings.EqualFold(rest, "Space"):
+		s.Rune = ' '
+	case utf8.RuneCountInString(rest) == 1:
+		s.Rune, _ = utf8.DecodeRuneInString(rest)
+	default:
+		return Stroke{}, fmt.Errorf("%q is not a key", name)
+	}
+	if s.Mod&tcell.ModCtrl != 0 {
+		return Stroke{}, fmt.Errorf("%q is not a key; control keys are Ctrl-A to Ctrl-Z and a few others", name)
+	}
+	return s, nil
+}
+
+// keyNamed returns the special key named, ignoring case.
+func keyNamed(name string) (tcell.Key, bool) {
+	for key, keyName := range tcell.KeyNames {
+		if strings.EqualFold(keyName, name) {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+// A Chord is a sequence of strokes bound as one.
+type Chord []Stroke
+
+func (c Chord) String() string {
+	names := make([]string, len(c))
+	for i, s := range c {
+		names[i] = s.String()
+	}
+	return strings.Join(names, " ")
+}
+
+// ParseChord reads strokes separated by spaces, such as "Ctrl-X Ctrl-S".
+func ParseChord(s string) (Chord, error) {
+	c := Chord{}
+	for _, name := range strings.Fields(s) {
+		stroke, err := ParseStroke(name)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, stroke)
+	}
+	if len(c) == 0 {
+		return nil, errors.New("no keys")
+	}
+	return c, nil
+}
+
+// A Keymap binds chords to action names in one context.
+type Keymap struct {
+	Name     string
+	parent   *Keymap
+	bindings map[string]string // by Chord.String
+	prefixes map[string]int    // how many bindings begin with each chord
+}
+
+// New returns an empty keymap that falls back on parent, if not nil.
+func New(name string, parent *Keymap) *Keymap {
+	return &Keymap{Name: name, parent: parent, bindings: map[string]string{}, prefixes: map[string]int{}}
+}
+
+// Bind binds c to action. Binding to "" hides any binding of c in
+// the parent keymaps.
+func (k *Keymap) Bind(c Chord, action string) {
+	key := c.String()
+	if _, ok := k.bindings[key]; !ok {
+		for i := 1; i < len(c); i += 1 {
+			k.prefixes[c[:i].String()] += 1
+		}
+	}
+	k.bindings[key] = action
+}
+
+// Lookup returns the action bound to c and the keymap that binds it.
+// If c is not bound but begins a longer chord that is, it returns
+// prefix true. A keymap's own bindings and chords come before those
+// of its parent; a key that begins a chord does nothing on its own.
+func (k *Keymap) Lookup(c Chord) (action string, from *Keymap, prefix bool) {
+	key := c.String()
+	for m := k; m != nil; m = m.parent {
+		if action, ok := m.bindings[key]; ok {
+			return action, m, false
+		}
+		if m.prefixes[key] > 0 {
+			return "", m, true
+		}
+	}
+	return "", nil, false
+}
+
+// Bindings returns the chords bound in k itself, not its parents, and
+// their actions.
+func (k *Keymap) Bindings() map[string]string {
+	result := map[string]string{}
+	for c, action := range k.bindings {
+		result[c] = action
+	}
+	return result
+}
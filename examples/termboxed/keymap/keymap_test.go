@@ -0,0 +1,75 @@
+package keymap
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func eq(t *testing.T, oops string, a, b interface{}) {
+	t.Helper()
+	if a != b {
+		t.Errorf("%s: got %v, expected %v.", oops, a, b)
+	}
+}
+
+func TestStrokes(t *testing.T) {
+	names := map[string]Stroke{
+		"F5":         {Key: tcell.KeyF5},
+		"Ctrl-X":     {Key: tcell.KeyCtrlX},
+		"Alt-x":      {Key: tcell.KeyRune, Rune: 'x', Mod: tcell.ModAlt},
+		"Space":      {Key: tcell.KeyRune, Rune: ' '},
+		"Ctrl-Up":    {Key: tcell.KeyUp, Mod: tcell.ModCtrl},
+		"Alt-Ctrl-A": {Key: tcell.KeyCtrlA, Mod: tcell.ModAlt},
+		"é":          {Key: tcell.KeyRune, Rune: 'é'},
+	}
+	for name, stroke := range names {
+		parsed, err := ParseStroke(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "parsed "+name, parsed, stroke)
+		eq(t, "named "+name, stroke.String(), name)
+	}
+	parsed, _ := ParseStroke("ctrl-x")
+	eq(t, "case ignored", parsed, names["Ctrl-X"])
+	for _, bad := range []string{"", "Hyper-X", "Ctrl-é", "Alt-"} {
+		_, err := ParseStroke(bad)
+		eq(t, "bad "+bad, err != nil, true)
+	}
+
+	eq(t, "ctrl keys with or without ModCtrl", StrokeOf(tcell.NewEventKey(tcell.KeyRune, 'x'-'a'+1, tcell.ModNone)), names["Ctrl-X"])
+	eq(t, "shifted rune", StrokeOf(tcell.NewEventKey(tcell.KeyRune, 'X', tcell.ModShift)), Stroke{Key: tcell.KeyRune, Rune: 'X'})
+}
+
+func TestLayeredLookup(t *testing.T) {
+	global := New("global", nil)
+	main := New("main", global)
+	chord := func(s string) Chord {
+		c, err := ParseChord(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	global.Bind(chord("Ctrl-Z"), "undo")
+	global.Bind(chord("Ctrl-X Ctrl-S"), "write")
+	global.Bind(chord("F1"), "help")
+	main.Bind(chord("Enter"), "newline")
+	main.Bind(chord("F1"), "")
+
+	action, from, prefix := main.Lookup(chord("Ctrl-Z"))
+	eq(t, "inherited", action, "undo")
+	eq(t, "inherited from", from, global)
+	_, _, prefix = main.Lookup(chord("Ctrl-X"))
+	eq(t, "chord prefix", prefix, true)
+	action, _, _ = main.Lookup(chord("Ctrl-X Ctrl-S"))
+	eq(t, "chord", action, "write")
+	action, from, _ = main.Lookup(chord("F1"))
+	eq(t, "hidden", action, "")
+	eq(t, "hidden by", from, main)
+	action, from, prefix = global.Lookup(chord("Enter"))
+	eq(t, "not bound", [3]interface{}{action, from == nil, prefix}, [3]interface{}{"", true, false})
+	_, err := ParseChord("  ")
+	eq(t, "empty chord", err != nil, true)
+}
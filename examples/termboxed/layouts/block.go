@@ -21,3 +21,8 @@ func (b *Block) Paint() error {
 	}
 	return nil
 }
+
+// Elements returns the handlers laid out by b, in order.
+func (b *Block) Elements() []events.Handler {
+	return b.elements
+}
@@ -0,0 +1,31 @@
+package layouts
+
+import (
+	"github.com/ehedgehog/guineapig/examples/termboxed/keymap"
+	"github.com/gdamore/tcell"
+)
+
+// The actions that layouts do themselves.
+const (
+	AddPanel = "new-panel" // a stack adds a new panel below the others
+	AddStack = "new-stack" // a shelf adds a new stack beside the others
+)
+
+// Keys are the keys that stacks and shelves act on rather than pass
+// to the element in focus. Only single keys are looked up.
+var Keys = DefaultKeys()
+
+// DefaultKeys returns the layout keys as they are before any are
+// rebound.
+func DefaultKeys() *keymap.Keymap {
+	k := keymap.New("layout", nil)
+	k.Bind(keymap.Chord{{Key: tcell.KeyCtrlU}}, AddPanel)
+	k.Bind(keymap.Chord{{Key: tcell.KeyCtrlT}}, AddStack)
+	return k
+}
+
+// action returns the layout action bound to e, if any.
+func action(e *tcell.EventKey) string {
+	a, _, _ := Keys.Lookup(keymap.Chord{keymap.StrokeOf(e)})
+	return a
+}
@@ -38,7 +38,7 @@ func (s *Shelf) Geometry() grid.Geometry {
 }
 
 func (b *Shelf) Key(e *tcell.EventKey) error {
-	if e.Key() == tcell.KeyCtrlT {
+	if action(e) == AddStack {
 		b.elements = append(b.elements, b.generator())
 		b.bounds = append(b.bounds, 0)
 		b.ResizeTo(b.recentSize)
@@ -42,13 +42,22 @@ func (s *Stack) Geometry() grid.Geometry {
 }
 
 func (b *Stack) Key(e *tcell.EventKey) error {
-	if e.Key() == tcell.KeyCtrlU {
+	if action(e) == AddPanel {
 		b.elements = append(b.elements, b.generator())
 		b.bounds = append(b.bounds, 0)
 		b.ResizeTo(b.recentSize)
 		return nil
 	}
-	return b.elements[b.focus].Key(e)
+	err := b.elements[b.focus].Key(e)
+	if s, ok := b.elements[b.focus].(events.Spawner); ok {
+		if h := s.Spawned(); h != nil {
+			b.elements = append(b.elements, h)
+			b.bounds = append(b.bounds, 0)
+			b.focus = len(b.elements) - 1
+			b.ResizeTo(b.recentSize)
+		}
+	}
+	return err
 }
 
 func (s *Stack) Mouse(e *tcell.EventMouse) error {
@@ -2,12 +2,28 @@
 // termboxed.main is a steering program for a text editor reminicient
 // of Poplog's ved but written in go as an exploratory tool.
 //
+//	termboxed [-layout shelf|stack] [-session file] [-config file] [-history file] [file[+line[:col]] ...]
+//
+// Each file named is opened in its own panel, side by side on the
+// shelf or one above another in a single stack. With -session and no
+// files named, the panels are as they were when that session was last
+// saved; the session is saved again on quitting. Settings are read
+// from the -config file, by default config.json in the termboxed
+// directory of the user's config directory. The command history is
+// kept between sessions in the -history file, by default history
+// beside the config file; an empty name keeps none.
+//
 package main
 
 import (
 	// "log"
 
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gdamore/tcell"
 )
@@ -18,7 +34,142 @@ import "github.com/ehedgehog/guineapig/examples/termboxed/layouts"
 import "github.com/ehedgehog/guineapig/examples/termboxed/events"
 import "github.com/ehedgehog/guineapig/examples/termboxed/edit"
 
+var layout = flag.String("layout", "shelf", "place files side by side (shelf) or one above another (stack)")
+var session = flag.String("session", "", "restore the session saved in this file, and save it there on quitting")
+var configFile = flag.String("config", edit.ConfigFile(), "read settings from this file")
+var historyFile = flag.String("history", edit.HistoryFile(), "keep the command history in this file")
+
+// openPanels returns an EditorPanel for each file argument, or a
+// single empty one if there are none.
+func openPanels(args []string) ([]events.Handler, error) {
+	if len(args) == 0 {
+		return []events.Handler{edit.NewEditorPanel()}, nil
+	}
+	panels := []events.Handler{}
+	for _, arg := range args {
+		fileName, where := edit.FileArgument(arg)
+		panel, err := edit.OpenEditorPanel(fileName, where)
+		if err != nil {
+			return nil, err
+		}
+		panels = append(panels, panel)
+	}
+	return panels, nil
+}
+
+// newStack returns a stack holding a new empty panel.
+func newStack() events.Handler {
+	return layouts.NewStack(edit.NewEditorPanel, edit.NewEditorPanel())
+}
+
+// arrange lays out the panels as the layout flag says.
+func arrange(layout string, panels []events.Handler) (events.Handler, error) {
+	switch layout {
+	case "shelf":
+		stacks := []events.Handler{}
+		for _, panel := range panels {
+			stacks = append(stacks, layouts.NewStack(edit.NewEditorPanel, panel))
+		}
+		return layouts.NewShelf(newStack, stacks...), nil
+	case "stack":
+		return layouts.NewShelf(newStack, layouts.NewStack(edit.NewEditorPanel, panels...)), nil
+	}
+	return nil, fmt.Errorf("unknown layout %v", layout)
+}
+
+// start returns the layout to begin with: the saved session if
+// there is one to restore, and otherwise the files named.
+func start(args []string) (events.Handler, error) {
+	if *session != "" && len(args) == 0 {
+		if _, err := os.Stat(*session); err == nil {
+			return loadSession(*session)
+		}
+	}
+	panels, err := openPanels(args)
+	if err != nil {
+		return nil, err
+	}
+	return arrange(*layout, panels)
+}
+
+// flagSet reports whether the named flag was given.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
 func main() {
+	flag.Parse()
+	configErr := edit.LoadConfig(*configFile, !flagSet("config"))
+	if edit.ConfigLayout() != "" && !flagSet("layout") {
+		*layout = edit.ConfigLayout()
+	}
+	eh, err := start(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "termboxed:", err)
+		os.Exit(1)
+	}
+	edit.SaveSession = func(fileName string) error {
+		if fileName == "" {
+			fileName = *session
+		}
+		return saveSession(fileName, eh)
+	}
+	if configErr != nil {
+		edit.Warn(strings.Replace(configErr.Error(), "\n", "; ", -1))
+	}
+	if *historyFile != "" {
+		if err := edit.LoadHistory(*historyFile); err != nil {
+			edit.Warn(err.Error())
+		}
+	}
+	run(eh)
+	if *historyFile != "" {
+		if err := edit.SaveHistory(*historyFile); err != nil {
+			fmt.Fprintln(os.Stderr, "termboxed:", err)
+		}
+	}
+	if *session != "" {
+		if err := saveSession(*session, eh); err != nil {
+			fmt.Fprintln(os.Stderr, "termboxed:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// watcher returns a function that, while turned on, wakes the event
+// loop every couple of seconds to look for files changed on disk.
+func watcher() func(on bool) {
+	var stop chan struct{}
+	return func(on bool) {
+		if on == (stop != nil) {
+			return
+		}
+		if !on {
+			close(stop)
+			stop = nil
+			return
+		}
+		stop = make(chan struct{})
+		go func(stop chan struct{}) {
+			ticker := time.NewTicker(2 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					screen.TheScreen.PostEvent(tcell.NewEventInterrupt(nil))
+				case <-stop:
+					return
+				}
+			}
+		}(stop)
+	}
+}
+
+// run shows eh on the screen and passes it events until the editor
+// is told to quit.
+func run(eh events.Handler) {
 	err := screen.TheScreen.Init()
 	if err != nil {
 		panic(err)
@@ -27,9 +178,8 @@ func main() {
 
 	page := screen.NewTermboxCanvas()
 
-	edA := layouts.NewStack(edit.NewEditorPanel, edit.NewEditorPanel())
-
-	eh := layouts.NewShelf(func() events.Handler { return layouts.NewStack(edit.NewEditorPanel, edit.NewEditorPanel()) }, edA)
+	edit.Watch = watcher()
+	defer edit.Watch(false)
 
 	eh.ResizeTo(page)
 	screen.TheScreen.EnableMouse()
@@ -52,12 +202,14 @@ func main() {
 			}
 		case *tcell.EventKey:
 			eh.Key(ev)
-			if ev.Key() == tcell.KeyCtrlX {
-				return
-			}
 		case *tcell.EventResize:
 			page = screen.NewTermboxCanvas()
 			eh.ResizeTo(page)
+		case *tcell.EventInterrupt:
+			edit.CheckFiles()
+		}
+		if edit.Quitting() {
+			return
 		}
 	}
 }
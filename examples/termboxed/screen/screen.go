@@ -3,6 +3,7 @@ package screen
 import (
 	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
 	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
 )
 
 ////////////////////////////////////////////////////////////////
@@ -19,6 +20,21 @@ var StyleBackCyan = DefaultStyle.Background(tcell.ColorLightCyan)
 
 var StyleBackYellow = DefaultStyle.Background(tcell.ColorLightCyan)
 
+// TabWidth is the number of cells between tab stops.
+var TabWidth = 4
+
+// RuneWidth returns the number of cells PutString uses to display ch
+// when it starts at the given cell; a tab reaches the next tab stop.
+func RuneWidth(ch rune, cell int) int {
+	if ch == '\t' {
+		return TabWidth - cell%TabWidth
+	}
+	if w := runewidth.RuneWidth(ch); w > 0 {
+		return w
+	}
+	return 1
+}
+
 func PutString(c Canvas, x, y int, content string, s tcell.Style) {
 	i := 0
 	size := c.Size()
@@ -35,13 +51,13 @@ func PutString(c Canvas, x, y int, content string, s tcell.Style) {
 		//			scurrent = &sprime
 		//		}
 		if ch == '\t' {
-			for counter := 0; counter < 4; counter += 1 {
-				c.SetCell(grid.LineCol{Col: x + i, Line: y}, ch, scurrent)
+			for counter := RuneWidth(ch, i); counter > 0; counter -= 1 {
+				c.SetCell(grid.LineCol{Col: x + i, Line: y}, ' ', scurrent)
 				i += 1
 			}
 		} else {
 			c.SetCell(grid.LineCol{Col: x + i, Line: y}, ch, scurrent)
-			i += 1
+			i += RuneWidth(ch, i)
 		}
 
 	}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/edit"
+	"github.com/ehedgehog/guineapig/examples/termboxed/events"
+	"github.com/ehedgehog/guineapig/examples/termboxed/layouts"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+// node is a saved handler: a shelf or stack of other nodes, or an
+// editor panel.
+type node struct {
+	Kind     string           `json:"kind"` // shelf, stack or panel
+	Children []node           `json:"children,omitempty"`
+	Panel    *edit.PanelState `json:"panel,omitempty"`
+}
+
+// sessionOf returns the saved form of eh.
+func sessionOf(eh events.Handler) (node, error) {
+	switch h := eh.(type) {
+	case *layouts.Shelf:
+		return nodeOf("shelf", h.Elements())
+	case *layouts.Stack:
+		return nodeOf("stack", h.Elements())
+	case *edit.EditorPanel:
+		s := h.SessionState()
+		return node{Kind: "panel", Panel: &s}, nil
+	}
+	return node{}, fmt.Errorf("cannot save a %T", eh)
+}
+
+func nodeOf(kind string, elements []events.Handler) (node, error) {
+	n := node{Kind: kind}
+	for _, element := range elements {
+		child, err := sessionOf(element)
+		if err != nil {
+			return node{}, err
+		}
+		n.Children = append(n.Children, child)
+	}
+	return n, nil
+}
+
+// restore rebuilds the handler saved as n.
+func restore(n node) (events.Handler, error) {
+	children := []events.Handler{}
+	for _, child := range n.Children {
+		h, err := restore(child)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, h)
+	}
+	if n.Kind != "panel" && len(children) == 0 {
+		return nil, fmt.Errorf("empty %v in session", n.Kind)
+	}
+	switch n.Kind {
+	case "shelf":
+		return layouts.NewShelf(newStack, children...), nil
+	case "stack":
+		return layouts.NewStack(edit.NewEditorPanel, children...), nil
+	case "panel":
+		if n.Panel == nil {
+			return nil, errors.New("panel without state in session")
+		}
+		return edit.RestoreEditorPanel(*n.Panel), nil
+	}
+	return nil, fmt.Errorf("unknown kind %q in session", n.Kind)
+}
+
+// saveSession writes the layout eh to the named session file, making
+// no backup of it.
+func saveSession(fileName string, eh events.Handler) error {
+	if fileName == "" {
+		return errors.New("no session file")
+	}
+	n, err := sessionOf(eh)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(n, "", "\t")
+	if err != nil {
+		return err
+	}
+	return text.WriteLinesWithoutBackup(fileName, strings.Split(string(data), "\n"))
+}
+
+// loadSession returns the layout saved in the named session file.
+func loadSession(fileName string) (events.Handler, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var n node
+	if err := json.Unmarshal(data, &n); err != nil {
+		return nil, fmt.Errorf("%v: %v", fileName, err)
+	}
+	if n.Kind != "shelf" {
+		return nil, fmt.Errorf("%v: not a saved session", fileName)
+	}
+	return restore(n)
+}
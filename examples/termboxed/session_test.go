@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/edit"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/layouts"
+	"github.com/ehedgehog/guineapig/examples/termboxed/text"
+)
+
+func eq(t *testing.T, oops string, a, b interface{}) {
+	t.Helper()
+	if a != b {
+		t.Errorf("%s: got %v, expected %v.", oops, a, b)
+	}
+}
+
+// saved returns the saved form of n as JSON, to compare layouts by.
+func saved(t *testing.T, n node) string {
+	t.Helper()
+	data, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "f")
+	os.WriteFile(name, []byte("a\nb\nc\n"), 0666)
+	h, err := edit.OpenEditorPanel(name, grid.LineCol{Line: 2, Col: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := layouts.NewShelf(newStack, layouts.NewStack(edit.NewEditorPanel, h, edit.NewEditorPanel()), newStack())
+	before, err := sessionOf(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "two stacks", len(before.Children), 2)
+	eq(t, "two panels in the first", len(before.Children[0].Children), 2)
+	eq(t, "panel file", before.Children[0].Children[0].Panel.File, name)
+	eq(t, "panel cursor", before.Children[0].Children[0].Panel.Where, grid.LineCol{Line: 2, Col: 1})
+
+	backups := text.Backups
+	text.Backups = text.NumberedBackup
+	defer func() { text.Backups = backups }()
+	session := filepath.Join(dir, "session")
+	for i := 0; i < 2; i += 1 {
+		if err := saveSession(session, layout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = os.Stat(session + ".~1~")
+	eq(t, "session not backed up", os.IsNotExist(err), true)
+	restored, err := loadSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := sessionOf(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eq(t, "layout restored", saved(t, after), saved(t, before))
+}
+
+func TestBadSessions(t *testing.T) {
+	dir := t.TempDir()
+	check := func(oops, content, message string) {
+		t.Helper()
+		name := filepath.Join(dir, "session")
+		os.WriteFile(name, []byte(content), 0666)
+		_, err := loadSession(name)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: got %v, expected an error containing %q.", oops, err, message)
+		}
+	}
+	check("not JSON", "shelf", "invalid character")
+	check("not a shelf", `{"kind": "stack", "children": [{"kind": "panel", "panel": {}}]}`, "not a saved session")
+	check("empty shelf", `{"kind": "shelf"}`, "empty shelf in session")
+	check("unknown kind", `{"kind": "shelf", "children": [{"kind": "drawer", "children": [{"kind": "panel", "panel": {}}]}]}`, `unknown kind "drawer"`)
+	check("panel without state", `{"kind": "shelf", "children": [{"kind": "panel"}]}`, "panel without state")
+	_, err := loadSession(filepath.Join(dir, "missing"))
+	eq(t, "missing file", os.IsNotExist(err), true)
+
+	name := filepath.Join(dir, "session")
+	os.WriteFile(name, []byte(`{"kind": "shelf", "children": [{"kind": "stack", "children": [
+		{"kind": "panel", "panel": {"directory": "`+filepath.Join(dir, "gone")+`"}},
+		{"kind": "panel", "panel": {"file": "`+name+`"}}]}]}`), 0666)
+	if _, err := loadSession(name); err != nil {
+		t.Errorf("missing directory: got %v, expected the rest restored.", err)
+	}
+}
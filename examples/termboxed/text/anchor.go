@@ -0,0 +1,154 @@
+package text
+
+import (
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+// Gravity says which side of an insertion an anchor sits at the
+// insertion point ends up on.
+type Gravity int
+
+const (
+	// StayBefore anchors stay in front of text inserted at them,
+	// and so stick to the text that precedes them.
+	StayBefore Gravity = iota
+
+	// MoveAfter anchors move past text inserted at them, and so
+	// stick to the text that follows them.
+	MoveAfter
+)
+
+// An Anchor is a position in a buffer that the buffer adjusts as
+// its content changes, so that it stays with the text around it.
+// An anchor can be moved like any LineCol; the buffer only adjusts
+// it when the buffer is changed.
+type Anchor struct {
+	grid.LineCol
+	Gravity Gravity
+	owner   *anchors
+}
+
+// Release tells the owning buffer that a is no longer needed.
+func (a *Anchor) Release() {
+	if a.owner != nil {
+		delete(a.owner.members, a)
+		a.owner = nil
+	}
+}
+
+// anchors is the set of anchors handed out by a buffer, together
+// with the adjustments each kind of edit makes to them. Buffers
+// embed it and call the adjustments after every change.
+type anchors struct {
+	members map[*Anchor]bool
+}
+
+func (s *anchors) NewAnchor(where grid.LineCol, g Gravity) *Anchor {
+	if s.members == nil {
+		s.members = map[*Anchor]bool{}
+	}
+	a := &Anchor{LineCol: where, Gravity: g, owner: s}
+	s.members[a] = true
+	return a
+}
+
+// textInserted adjusts for n runes inserted at where.
+func (s *anchors) textInserted(where grid.LineCol, n int) {
+	for a := range s.members {
+		if a.Line == where.Line && (a.Col > where.Col || a.Col == where.Col && a.Gravity == MoveAfter) {
+			a.Col += n
+		}
+	}
+}
+
+// textDeleted adjusts for n runes deleted at where.
+func (s *anchors) textDeleted(where grid.LineCol, n int) {
+	for a := range s.members {
+		if a.Line == where.Line && a.Col > where.Col {
+			a.Col = where.Col + bounds.Max(a.Col-where.Col-n, 0)
+		}
+	}
+}
+
+// textSpliced adjusts for text inserted at where which ends at end,
+// perhaps on a later line.
+func (s *anchors) textSpliced(where, end grid.LineCol) {
+	for a := range s.members {
+		if a.Line > where.Line {
+			a.Line += end.Line - where.Line
+		} else if a.Line == where.Line && (a.Col > where.Col || a.Col == where.Col && a.Gravity == MoveAfter) {
+			a.Line, a.Col = end.Line, a.Col-where.Col+end.Col
+		}
+	}
+}
+
+// lineSplit adjusts for a line being split in two at where.
+func (s *anchors) lineSplit(where grid.LineCol) {
+	for a := range s.members {
+		if a.Line > where.Line {
+			a.Line += 1
+		} else if a.Line == where.Line && (a.Col > where.Col || a.Col == where.Col && a.Gravity == MoveAfter) {
+			a.Line += 1
+			a.Col -= where.Col
+		}
+	}
+}
+
+// linesJoined adjusts for line+1 being appended to line, which was
+// col runes long.
+func (s *anchors) linesJoined(line, col int) {
+	for a := range s.members {
+		if a.Line == line+1 {
+			a.Line, a.Col = line, a.Col+col
+		} else if a.Line > line+1 {
+			a.Line -= 1
+		}
+	}
+}
+
+// linesReplaced adjusts for lines [low, high) being replaced by n
+// lines. Anchors in a replaced line stay on that line if there still
+// is one and go to the start of the line following the replacement
+// otherwise.
+func (s *anchors) linesReplaced(low, high, n int) {
+	for a := range s.members {
+		switch {
+		case a.Line < low:
+		case low == high && a.Line == low && a.Col == 0 && a.Gravity == StayBefore:
+		case a.Line >= high:
+			a.Line += n - (high - low)
+		case a.Line >= low+n:
+			a.Line, a.Col = low+n, 0
+		}
+	}
+}
+
+// linesMoved adjusts for lines [first, last] being moved to follow
+// line target. Anchors at the start of a line that stay before
+// insertions belong to the end of the previous line, so an anchor at
+// the start of the line after the moved lines goes with them, and one
+// at the start of the first moved line does not.
+func (s *anchors) linesMoved(first, last, target int) {
+	moved := func(line int) int {
+		size := last - first + 1
+		switch {
+		case target < first && target < line && line < first:
+			return line + size
+		case target > last && last < line && line <= target:
+			return line - size
+		case first <= line && line <= last && target < first:
+			return line - first + target + 1
+		case first <= line && line <= last:
+			return line - first + target - size + 1
+		}
+		return line
+	}
+	for a := range s.members {
+		if a.Col == 0 && a.Gravity == StayBefore && a.Line > 0 {
+			a.Line = moved(a.Line-1) + 1
+		} else {
+			a.Line = moved(a.Line)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package text
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+func TestAnchorFollowsTextEdits(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "abcdef\nghijkl\n")
+		before := b.NewAnchor(grid.LineCol{Line: 0, Col: 3}, StayBefore)
+		after := b.NewAnchor(grid.LineCol{Line: 0, Col: 3}, MoveAfter)
+		below := b.NewAnchor(grid.LineCol{Line: 1, Col: 2}, StayBefore)
+
+		b.Insert(grid.LineCol{Line: 0, Col: 3}, 'X')
+		eq(t, "StayBefore at insertion", before.LineCol, grid.LineCol{Line: 0, Col: 3})
+		eq(t, "MoveAfter at insertion", after.LineCol, grid.LineCol{Line: 0, Col: 4})
+
+		b.DeleteBack(grid.LineCol{Line: 0, Col: 2})
+		eq(t, "deletion before anchor", before.LineCol, grid.LineCol{Line: 0, Col: 2})
+
+		b.Return(grid.LineCol{Line: 0, Col: 1})
+		eq(t, "split before anchor", after.LineCol, grid.LineCol{Line: 1, Col: 2})
+		eq(t, "line below split", below.LineCol, grid.LineCol{Line: 2, Col: 2})
+
+		b.DeleteBack(grid.LineCol{Line: 1, Col: 0})
+		eq(t, "content after join", content(b), "acXdef|ghijkl")
+		eq(t, "join moves anchor up", after.LineCol, grid.LineCol{Line: 0, Col: 3})
+		eq(t, "line below join", below.LineCol, grid.LineCol{Line: 1, Col: 2})
+
+		after.Release()
+		b.DeleteLine(grid.LineCol{Line: 0})
+		eq(t, "released anchor is left alone", after.LineCol, grid.LineCol{Line: 0, Col: 3})
+		eq(t, "line below deletion", below.LineCol, grid.LineCol{Line: 0, Col: 2})
+	})
+}
+
+func TestMarkedRangeFollowsEdits(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "0\n1\n2\n3\n4\n5\n6\n")
+		mr := NewMarkedRange(b)
+		mr.SetLow(2)
+		mr.SetHigh(3)
+		check := func(what string, first, last int) {
+			t.Helper()
+			f, l := mr.Range()
+			eq(t, what+": first", f, first)
+			eq(t, what+": last", l, last)
+		}
+		check("initially", 2, 3)
+
+		b.Return(grid.LineCol{Line: 0, Col: 1})
+		check("after return above", 3, 4)
+		b.Return(grid.LineCol{Line: 4, Col: 1})
+		check("after return on last line", 3, 5)
+		b.DeleteLine(grid.LineCol{Line: 5})
+		check("after deleting last line", 3, 4)
+		b.DeleteBack(grid.LineCol{Line: 1, Col: 0})
+		check("after join above", 2, 3)
+		b.MoveLines(grid.LineCol{Line: 5}, 2, 3)
+		check("after moving the range down", 4, 5)
+		b.MoveLines(grid.LineCol{Line: 0}, 4, 5)
+		check("after moving the range up", 1, 2)
+		b.ReadFromFile(grid.LineCol{}, "", bytesOfLines(3))
+		check("after reading above", 4, 5)
+		b.ReadFromFile(grid.LineCol{Line: 4, Col: 1}, "", strings.NewReader("x\ny"))
+		check("after reading within", 4, 6)
+		b.ReadFromFile(grid.LineCol{Line: 20}, "", bytesOfLines(3))
+		check("after reading at the end", 4, 6)
+		b.DeleteLines(grid.LineCol{}, 4, 6)
+		eq(t, "inactive once deleted", mr.IsActive(), false)
+	})
+}
+
+func TestAdjacentRangesMoveApart(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "0\n1\n2\n3\n4\n5\n")
+		upper, lower := NewMarkedRange(b), NewMarkedRange(b)
+		upper.SetRange(0, 1)
+		lower.SetRange(2, 3)
+		b.MoveLines(grid.LineCol{Line: 5}, 2, 3)
+		first, last := upper.Range()
+		eq(t, "upper range stays", [2]int{first, last}, [2]int{0, 1})
+		first, last = lower.Range()
+		eq(t, "lower range moves", [2]int{first, last}, [2]int{4, 5})
+	})
+}
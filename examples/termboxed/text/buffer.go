@@ -1,10 +1,9 @@
 package text
 
 import (
-	"bufio"
+	"crypto/sha256"
 	//	"errors"
 	"io"
-	"os"
 )
 
 import "github.com/ehedgehog/guineapig/examples/termboxed/screen"
@@ -19,10 +18,13 @@ type Buffer interface {
 
 	MoveLines(where grid.LineCol, firstLine, lastLine int)
 
+	// ReplaceLines replaces lines [low, high) with the given lines.
+	ReplaceLines(low, high int, lines []string)
+
 	DeleteLines(where grid.LineCol, lowLine, highLine int) grid.LineCol
 
 	// DeleteBack delete the previous rune if not at line start. Otherwise
-	// it does nothing.
+	// it joins the line to the previous one.
 	DeleteBack(grid.LineCol) grid.LineCol
 
 	// DeleteForward delete the current rune if there are any runes
@@ -34,20 +36,53 @@ type Buffer interface {
 
 	Execute(grid.LineCol) (grid.LineCol, error)
 
-	PutLines(c screen.Canvas, first, n int)
+	// PutLines shows n lines starting at line first on c, each
+	// scrolled left so that display cell left is at the edge of c.
+	PutLines(c screen.Canvas, first, n, left int)
 
 	// attempt to eliminate?
 	Expose() []string
 
-	// ReadFromFile reads from r inserting the content at the current position.
+	// LineCount returns the number of lines in the buffer.
+	LineCount() int
+
+	// Line returns the content of line n, which must be in range.
+	Line(n int) string
+
+	// ReadFromFile reads from r inserting the content at the current
+	// position, or after the last line if that is beyond the end of the
+	// buffer, and returns where the inserted content ends. Only a read
+	// into an empty buffer gives it a file name.
 	ReadFromFile(where grid.LineCol, fileName string, r io.Reader) (grid.LineCol, error)
 
+	// WriteToFile safely replaces the named file, or the file last
+	// read if no name is given, with the content of the buffer. It
+	// fails if there is no name to use. Writing a copy to another file
+	// leaves the buffer belonging to its own file.
 	WriteToFile(fileName []string) error
+
+	// Generation returns a number that changes whenever the buffer
+	// does, and Modified whether the buffer has changed since it was
+	// read into empty or last written to its file.
+	Generation() int
+	Modified() bool
+
+	// FileName returns the name of the file the buffer was read from
+	// or last written to, and FileStamp that file's stamp as it was
+	// when the buffer last matched it.
+	FileName() string
+	FileStamp() Stamp
+
+	// NewAnchor returns an anchor at where which the buffer keeps
+	// up to date as its content changes.
+	NewAnchor(where grid.LineCol, g Gravity) *Anchor
 }
 
 // SimpleBuffer is a simplistic implementation of
 // Buffer. It burns store like it was November 5th.
 type SimpleBuffer struct {
+	anchors
+	versions
 	content  []string                   // existing lines of text
 	execute  func(Buffer, string) error // execute command on buffer at line
 	fileName string                     // file name used for most recent read
@@ -57,6 +92,14 @@ func (b *SimpleBuffer) Expose() (content []string) {
 	return b.content
 }
 
+func (b *SimpleBuffer) LineCount() int {
+	return len(b.content)
+}
+
+func (b *SimpleBuffer) Line(n int) string {
+	return b.content[n]
+}
+
 func (b *SimpleBuffer) MoveLines(where grid.LineCol, firstLine, lastLine int) {
 	lines := b.content
 	target := where.Line
@@ -81,11 +124,25 @@ func (b *SimpleBuffer) MoveLines(where grid.LineCol, firstLine, lastLine int) {
 	}
 
 	b.content = newContent
+	b.linesMoved(firstLine, lastLine, target)
+	b.changed()
+}
+
+func (b *SimpleBuffer) ReplaceLines(low, high int, lines []string) {
+	newContent := make([]string, 0, len(b.content)-(high-low)+len(lines))
+	newContent = append(newContent, b.content[0:low]...)
+	newContent = append(newContent, lines...)
+	newContent = append(newContent, b.content[high:]...)
+	b.content = newContent
+	b.linesReplaced(low, high, len(lines))
+	b.changed()
 }
 
 func (b *SimpleBuffer) DeleteLines(where grid.LineCol, lowLine, highLine int) grid.LineCol {
-	if 0 <= lowLine && lowLine <= highLine && highLine <= len(b.content) {
+	if 0 <= lowLine && lowLine <= highLine && highLine < len(b.content) {
 		b.content = append(b.content[0:lowLine], b.content[highLine+1:]...)
+		b.linesReplaced(lowLine, highLine+1, 0)
+		b.changed()
 		if where.Line >= lowLine {
 			if where.Line <= highLine {
 				where.Line = lowLine
@@ -99,16 +156,20 @@ func (b *SimpleBuffer) DeleteLines(where grid.LineCol, lowLine, highLine int) gr
 
 func (b *SimpleBuffer) DeleteLine(where grid.LineCol) grid.LineCol {
 	line := where.Line
-	if line == 0 {
-		b.content = b.content[1:]
-	} else if line < len(b.content) {
+	if line < len(b.content) {
 		b.content = append(b.content[0:line], b.content[line+1:]...)
+		b.linesReplaced(line, line+1, 0)
+		b.changed()
 	} else {
 		// nothing to do -- deleting virtual line
 	}
 	return where
 }
 
+func (b *SimpleBuffer) FileName() string {
+	return b.fileName
+}
+
 func (b *SimpleBuffer) WriteToFile(fileNameOption []string) error {
 	fileName := ""
 	if len(fileNameOption) > 0 {
@@ -117,30 +178,37 @@ func (b *SimpleBuffer) WriteToFile(fileNameOption []string) error {
 	if len(fileName) == 0 {
 		fileName = b.fileName
 	}
-	f, err := os.Create(fileName)
-	if err == nil {
-		// horrid. couldn't we at least contrive to call WriteString?
-		// or use bufio and buffer up the bytes?
-		defer f.Close()
-		for _, line := range b.content {
-			f.Write([]byte(line))
-			f.Write([]byte{'\n'})
-		}
-	} else {
-		return err
+	stamp, err := writeLines(fileName, Backups, converted(fileName, eachOf(b.content)))
+	if err == nil && (b.fileName == "" || fileName == b.fileName) {
+		b.fileName = fileName
+		b.markSaved(stamp)
 	}
-	return nil
+	return err
 }
 
 func (b *SimpleBuffer) ReadFromFile(where grid.LineCol, fileName string, r io.Reader) (grid.LineCol, error) {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		b.content = append(b.content, line)
+	n := len(b.content)
+	h := sha256.New()
+	read := []string{}
+	ended, err := readLines(io.TeeReader(r, h), func(line string) { read = append(read, line) })
+	low, high, lines, end := splicing(b, where, read, ended)
+	newContent := make([]string, 0, len(b.content)-(high-low)+len(lines))
+	newContent = append(newContent, b.content[0:low]...)
+	newContent = append(newContent, lines...)
+	b.content = append(newContent, b.content[high:]...)
+	if low == high {
+		b.linesReplaced(low, high, len(lines))
+	} else {
+		b.textSpliced(where, end)
+	}
+	b.changed()
+	if n == 0 {
+		b.fileName = fileName
+		if err == nil {
+			b.markSaved(readStamp(fileName, h))
+		}
 	}
-	where.Line = 0
-	b.fileName = fileName
-	return where, nil
+	return end, err
 }
 
 func (b *SimpleBuffer) makeRoom(where grid.LineCol) {
@@ -150,24 +218,15 @@ func (b *SimpleBuffer) makeRoom(where grid.LineCol) {
 		copy(content, b.content)
 		b.content = content
 	}
-	for col > len(b.content[line]) {
-		b.content[line] += "        "
-	}
+	b.content[line] = padLine(b.content[line], col)
 }
 
 func (b *SimpleBuffer) Insert(where grid.LineCol, ch rune) {
 
 	b.makeRoom(where)
-
-	loc := where.Col
-	runes := []rune(b.content[where.Line])
-
-	A := []rune{}
-	B := append(A, runes[0:loc]...)
-	C := append(B, ch)
-	D := append(C, runes[loc:]...)
-
-	b.content[where.Line] = string(D)
+	b.content[where.Line] = insertRune(b.content[where.Line], where.Col, ch)
+	b.textInserted(where, 1)
+	b.changed()
 }
 
 func (b *SimpleBuffer) Execute(where grid.LineCol) (grid.LineCol, error) {
@@ -175,7 +234,27 @@ func (b *SimpleBuffer) Execute(where grid.LineCol) (grid.LineCol, error) {
 	return where, b.execute(b, b.content[where.Line])
 }
 
-func NewBuffer(execute func(Buffer, string) error) Buffer {
+// An Option configures the buffer made by NewBuffer.
+type Option func(*options)
+
+type options struct {
+	rope bool
+}
+
+// WithRope selects the RopeBuffer implementation, which keeps edit
+// costs logarithmic in the size of the buffer.
+func WithRope() Option {
+	return func(o *options) { o.rope = true }
+}
+
+func NewBuffer(execute func(Buffer, string) error, opts ...Option) Buffer {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.rope {
+		return &RopeBuffer{execute: execute}
+	}
 	return &SimpleBuffer{
 		content: []string{},
 		execute: execute,
@@ -189,12 +268,13 @@ func (b *SimpleBuffer) Return(where grid.LineCol) grid.LineCol {
 	lines := append(b.content, "")
 
 	line, col := where.Line, where.Col
-	right := lines[line][col:]
-	left := lines[line][0:col]
+	left, right := splitLine(lines[line], col)
 
 	copy(lines[line+1:], lines[line:])
 	lines[line] = left
 	lines[line+1] = right
+	b.lineSplit(where)
+	b.changed()
 	where.DownOne()
 	where.Col = 0
 	b.content = lines
@@ -205,12 +285,17 @@ func (b *SimpleBuffer) DeleteBack(where grid.LineCol) grid.LineCol {
 	b.makeRoom(where)
 	line, col := where.Line, where.Col
 	if col > 0 {
-		content := b.content[line]
-		before := content[0 : col-1]
-		after := content[col:]
-		newContent := before + after
-		b.content[line] = newContent
+		b.content[line] = deleteRune(b.content[line], col-1)
 		where.LeftOne()
+		b.textDeleted(where, 1)
+		b.changed()
+	} else if line > 0 {
+		previous := b.content[line-1]
+		b.content[line-1] = previous + b.content[line]
+		b.content = append(b.content[0:line], b.content[line+1:]...)
+		where = grid.LineCol{Line: line - 1, Col: RuneCount(previous)}
+		b.linesJoined(line-1, where.Col)
+		b.changed()
 	}
 	return where
 }
@@ -220,11 +305,11 @@ func (b *SimpleBuffer) DeleteForward(where grid.LineCol) grid.LineCol {
 	return b.DeleteBack(where)
 }
 
-func (b *SimpleBuffer) PutLines(w screen.Canvas, first, n int) {
+func (b *SimpleBuffer) PutLines(w screen.Canvas, first, n, left int) {
 	content := b.content
 	row := 0
 	for line := first; 0 <= line && line < len(content) && row < n; line += 1 {
-		screen.PutString(w, 0, row, content[line], screen.DefaultStyle)
+		putLine(w, row, content[line], left)
 		row += 1
 	}
 }
@@ -1,6 +1,13 @@
 package text
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
 
 func TestCanCreateBuffer(t *testing.T) {
 //	b := New(execFunction).(*SimpleBuffer)
@@ -66,3 +73,182 @@ func TestCanCreateBuffer(t *testing.T) {
 //		t.Errorf("%s: got %v, expected %v.", oops, a, b)
 //	}
 //}
+
+// buffers names the Buffer implementations that every behavioural
+// test is run against.
+var buffers = []struct {
+	name string
+	opts []Option
+}{
+	{"simple", nil},
+	{"rope", []Option{WithRope()}},
+}
+
+func forEachBuffer(t *testing.T, test func(t *testing.T, b Buffer)) {
+	for _, kind := range buffers {
+		t.Run(kind.name, func(t *testing.T) {
+			test(t, NewBuffer(execNothing, kind.opts...))
+		})
+	}
+}
+
+func execNothing(b Buffer, s string) error {
+	return nil
+}
+
+func eq(t *testing.T, oops string, a, b interface{}) {
+	t.Helper()
+	if a != b {
+		t.Errorf("%s: got %v, expected %v.", oops, a, b)
+	}
+}
+
+func content(b Buffer) string {
+	return strings.Join(b.Expose(), "|")
+}
+
+func load(t *testing.T, b Buffer, text string) {
+	t.Helper()
+	if _, err := b.ReadFromFile(grid.LineCol{}, "", strings.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertCharacterInEmptyBuffer(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		b.Insert(grid.LineCol{}, '1')
+		eq(t, "should have just one line", b.LineCount(), 1)
+		eq(t, "line should be '1'", b.Line(0), "1")
+	})
+}
+
+func TestInsertBeyondEndMakesRoom(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		b.Insert(grid.LineCol{Line: 2, Col: 0}, 'x')
+		eq(t, "should have three lines", b.LineCount(), 3)
+		eq(t, "content", content(b), "||x")
+	})
+}
+
+func TestInsertWithinLine(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "one\ntwo\n")
+		b.Insert(grid.LineCol{Line: 1, Col: 1}, 'X')
+		eq(t, "content", content(b), "one|tXwo")
+	})
+}
+
+func TestReturnSplitsLine(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "abcdef\nxyz\n")
+		where := b.Return(grid.LineCol{Line: 0, Col: 2})
+		eq(t, "content", content(b), "ab|cdef|xyz")
+		eq(t, "cursor", where, grid.LineCol{Line: 1, Col: 0})
+	})
+}
+
+func TestDeleteBackAndForward(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "abcdef\n")
+		where := b.DeleteBack(grid.LineCol{Line: 0, Col: 2})
+		eq(t, "after DeleteBack", content(b), "acdef")
+		eq(t, "cursor after DeleteBack", where, grid.LineCol{Line: 0, Col: 1})
+		where = b.DeleteForward(where)
+		eq(t, "after DeleteForward", content(b), "adef")
+		eq(t, "cursor after DeleteForward", where, grid.LineCol{Line: 0, Col: 1})
+		where = b.DeleteBack(grid.LineCol{Line: 0, Col: 0})
+		eq(t, "DeleteBack at line start", content(b), "adef")
+	})
+}
+
+func TestDeleteLine(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "a\nb\nc\n")
+		b.DeleteLine(grid.LineCol{Line: 1})
+		eq(t, "content", content(b), "a|c")
+		b.DeleteLine(grid.LineCol{Line: 5})
+		eq(t, "deleting virtual line", content(b), "a|c")
+		b.DeleteLine(grid.LineCol{Line: 0})
+		eq(t, "deleting first line", content(b), "c")
+	})
+}
+
+func TestDeleteLines(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "0\n1\n2\n3\n4\n5\n")
+		where := b.DeleteLines(grid.LineCol{Line: 5, Col: 1}, 1, 3)
+		eq(t, "content", content(b), "0|4|5")
+		eq(t, "cursor below range moves up", where, grid.LineCol{Line: 2, Col: 1})
+		where = b.DeleteLines(grid.LineCol{Line: 1}, 1, 1)
+		eq(t, "cursor within range moves to start", where, grid.LineCol{Line: 1})
+		eq(t, "content", content(b), "0|5")
+	})
+}
+
+func TestMoveLines(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "0\n1\n2\n3\n4\n5\n")
+		b.MoveLines(grid.LineCol{Line: 0}, 3, 4)
+		eq(t, "moved backward", content(b), "0|3|4|1|2|5")
+		b.MoveLines(grid.LineCol{Line: 5}, 1, 2)
+		eq(t, "moved forward", content(b), "0|1|2|5|3|4")
+		b.MoveLines(grid.LineCol{Line: -1}, 4, 5)
+		eq(t, "moved to the top", content(b), "3|4|0|1|2|5")
+	})
+}
+
+func TestExecuteSeesLine(t *testing.T) {
+	for _, kind := range buffers {
+		t.Run(kind.name, func(t *testing.T) {
+			seen := ""
+			b := NewBuffer(func(b Buffer, s string) error { seen = s; return nil }, kind.opts...)
+			load(t, b, "first\nsecond\n")
+			b.Execute(grid.LineCol{Line: 1})
+			eq(t, "executed line", seen, "second")
+		})
+	}
+}
+
+func TestWriteThenRead(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		fileName := filepath.Join(t.TempDir(), "out.txt")
+		load(t, b, "alpha\nbeta\n")
+		if err := b.WriteToFile([]string{fileName}); err != nil {
+			t.Fatal(err)
+		}
+		written, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "file content", string(written), "alpha\nbeta\n")
+	})
+}
+
+func TestReadSplicesAtPosition(t *testing.T) {
+	cases := []struct {
+		name  string
+		where grid.LineCol
+		text  string
+		want  string
+		end   grid.LineCol
+	}{
+		{"within line", grid.LineCol{Line: 0, Col: 2}, "xy", "abxycd|ef", grid.LineCol{Line: 0, Col: 4}},
+		{"lines within line", grid.LineCol{Line: 0, Col: 2}, "x\ny\n", "abx|y|cd|ef", grid.LineCol{Line: 2, Col: 0}},
+		{"unended lines", grid.LineCol{Line: 1, Col: 0}, "x\ny", "abcd|x|yef", grid.LineCol{Line: 2, Col: 1}},
+		{"past line end", grid.LineCol{Line: 1, Col: 4}, "x", "abcd|ef  x", grid.LineCol{Line: 1, Col: 5}},
+		{"past buffer end", grid.LineCol{Line: 5, Col: 3}, "x\ny\n", "abcd|ef|x|y", grid.LineCol{Line: 4, Col: 0}},
+		{"nothing", grid.LineCol{Line: 1, Col: 1}, "", "abcd|ef", grid.LineCol{Line: 1, Col: 1}},
+	}
+	for _, c := range cases {
+		forEachBuffer(t, func(t *testing.T, b Buffer) {
+			load(t, b, "abcd\nef\n")
+			end, err := b.ReadFromFile(c.where, "other", strings.NewReader(c.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			eq(t, c.name+": content", content(b), c.want)
+			eq(t, c.name+": end", end, c.end)
+			eq(t, c.name+": file name kept", b.FileName(), "")
+		})
+	}
+}
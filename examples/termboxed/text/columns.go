@@ -0,0 +1,131 @@
+package text
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+)
+
+// Columns within a line are rune indexes throughout the text package:
+// column n is the position before the n'th rune of the line. The
+// functions here convert columns to and from byte offsets and the
+// display cells that screen.PutString uses.
+
+// RuneCount returns the number of columns in line.
+func RuneCount(line string) int {
+	return utf8.RuneCountInString(line)
+}
+
+// ByteOffset returns the byte offset in line of column col. Columns
+// beyond the end of the line map to len(line).
+func ByteOffset(line string, col int) int {
+	for offset := range line {
+		if col <= 0 {
+			return offset
+		}
+		col -= 1
+	}
+	return len(line)
+}
+
+// DisplayColumn returns the display cell at which column col of
+// line is shown. Columns beyond the end of the line are taken to be
+// single-width spaces.
+func DisplayColumn(line string, col int) int {
+	cells := 0
+	for _, ch := range line {
+		if col <= 0 {
+			return cells
+		}
+		cells += screen.RuneWidth(ch, cells)
+		col -= 1
+	}
+	return cells + col
+}
+
+// ColumnAt returns the column of line that is shown at display cell
+// cells; a cell in the middle of a wide rune or a tab maps to that rune.
+func ColumnAt(line string, cells int) int {
+	col, at := 0, 0
+	for _, ch := range line {
+		at += screen.RuneWidth(ch, at)
+		if at > cells {
+			return col
+		}
+		col += 1
+	}
+	return col + bounds.Max(cells-at, 0)
+}
+
+// padLine returns line extended with spaces to at least col columns.
+func padLine(line string, col int) string {
+	if n := RuneCount(line); col > n {
+		return line + strings.Repeat(" ", col-n)
+	}
+	return line
+}
+
+// insertRune returns line with ch inserted at column col.
+func insertRune(line string, col int, ch rune) string {
+	i := ByteOffset(line, col)
+	return line[:i] + string(ch) + line[i:]
+}
+
+// deleteRune returns line with the rune at column col removed.
+func deleteRune(line string, col int) string {
+	i := ByteOffset(line, col)
+	_, size := utf8.DecodeRuneInString(line[i:])
+	return line[:i] + line[i+size:]
+}
+
+// splitLine returns the parts of line before and after column col.
+func splitLine(line string, col int) (string, string) {
+	i := ByteOffset(line, col)
+	return line[:i], line[i:]
+}
+
+// DisplayWidth returns the number of display cells line occupies.
+func DisplayWidth(line string) int {
+	return DisplayColumn(line, RuneCount(line))
+}
+
+// putLine shows line in row of w, starting from display cell left of
+// the line. Tabs are shown as spaces up to the next tab stop. A wide
+// rune cut by the edge of w is left blank.
+func putLine(w screen.Canvas, row int, line string, left int) {
+	width := w.Size().Width
+	cells := 0
+	for _, ch := range line {
+		n := screen.RuneWidth(ch, cells)
+		if cells-left >= width {
+			return
+		}
+		if ch == '\t' {
+			for i := bounds.Max(cells, left); i < cells+n && i-left < width; i += 1 {
+				w.SetCell(grid.LineCol{Line: row, Col: i - left}, ' ', screen.DefaultStyle)
+			}
+		} else if cells >= left && cells+n-left <= width {
+			w.SetCell(grid.LineCol{Line: row, Col: cells - left}, ch, screen.DefaultStyle)
+		}
+		cells += n
+	}
+}
+
+// Retab returns line with the spaces and tabs that indent it replaced
+// by as many tabs as fit in the same width, followed by spaces, for
+// tab stops every width cells.
+func Retab(line string, width int) string {
+	cells, i := 0, 0
+	for ; i < len(line) && (line[i] == ' ' || line[i] == '\t'); i += 1 {
+		if line[i] == '\t' {
+			cells += width - cells%width
+		} else {
+			cells += 1
+		}
+	}
+	indent := strings.Repeat("\t", cells/width) + strings.Repeat(" ", cells%width)
+	return indent + line[i:]
+}
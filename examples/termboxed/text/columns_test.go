@@ -0,0 +1,115 @@
+package text
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+	"github.com/gdamore/tcell"
+)
+
+const quoted = "‘smart’ “dashes” — 世界"
+
+func TestByteOffset(t *testing.T) {
+	eq(t, "start", ByteOffset(quoted, 0), 0)
+	eq(t, "after open quote", ByteOffset(quoted, 1), 3)
+	eq(t, "after 'smart'", ByteOffset(quoted, 6), 8)
+	eq(t, "end", ByteOffset(quoted, RuneCount(quoted)), len(quoted))
+	eq(t, "beyond end", ByteOffset(quoted, 100), len(quoted))
+}
+
+func TestDisplayColumn(t *testing.T) {
+	n := RuneCount(quoted)
+	eq(t, "narrow runes are one cell", DisplayColumn(quoted, 3), 3)
+	eq(t, "wide runes are two cells", DisplayColumn(quoted, n), n+2)
+	eq(t, "beyond end", DisplayColumn("ab", 4), 4)
+	eq(t, "tab", DisplayColumn("\tx", 1), 4)
+}
+
+func TestColumnAt(t *testing.T) {
+	n := RuneCount(quoted)
+	for col := 0; col <= n+2; col += 1 {
+		eq(t, "round trip", ColumnAt(quoted, DisplayColumn(quoted, col)), col)
+	}
+	eq(t, "middle of wide rune", ColumnAt("世界", 1), 0)
+	eq(t, "before start", ColumnAt("", -3), 0)
+}
+
+func TestMultiByteEditing(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, quoted+"\n")
+		b.Insert(grid.LineCol{Line: 0, Col: 1}, 'S')
+		eq(t, "insert after quote", content(b), "‘Ssmart’ “dashes” — 世界")
+		where := b.DeleteBack(grid.LineCol{Line: 0, Col: 8})
+		eq(t, "delete closing quote", content(b), "‘Ssmart “dashes” — 世界")
+		eq(t, "cursor after delete", where, grid.LineCol{Line: 0, Col: 7})
+		b.DeleteForward(grid.LineCol{Line: 0, Col: 0})
+		eq(t, "delete opening quote", content(b), "Ssmart “dashes” — 世界")
+		where = b.Return(grid.LineCol{Line: 0, Col: 16})
+		eq(t, "split before dash", content(b), "Ssmart “dashes” |— 世界")
+		eq(t, "cursor after split", where, grid.LineCol{Line: 1, Col: 0})
+		b.Insert(grid.LineCol{Line: 1, Col: 6}, '!')
+		eq(t, "insert beyond end pads by runes", b.Line(1), "— 世界  !")
+	})
+}
+
+// cellCanvas is a screen.Canvas that remembers what is put on it.
+type cellCanvas struct {
+	size  grid.Size
+	cells map[grid.LineCol]rune
+}
+
+func newCellCanvas(w, h int) *cellCanvas {
+	return &cellCanvas{size: grid.Size{Width: w, Height: h}, cells: map[grid.LineCol]rune{}}
+}
+
+func (c *cellCanvas) Size() grid.Size              { return c.size }
+func (c *cellCanvas) SetCursor(where grid.LineCol) {}
+
+func (c *cellCanvas) SetCell(where grid.LineCol, ch rune, s tcell.Style) {
+	if 0 <= where.Col && where.Col < c.size.Width && 0 <= where.Line && where.Line < c.size.Height {
+		c.cells[where] = ch
+	}
+}
+
+// row returns row line of c, with blanks as dots.
+func (c *cellCanvas) row(line int) string {
+	var b strings.Builder
+	for col := 0; col < c.size.Width; col += 1 {
+		if ch, ok := c.cells[grid.LineCol{Line: line, Col: col}]; ok {
+			b.WriteRune(ch)
+		} else {
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+func TestPutLinesScrolledLeft(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "abcdefgh\n世界xyz\nab\n")
+		c := newCellCanvas(4, 3)
+		b.PutLines(c, 0, 3, 3)
+		eq(t, "narrow line", c.row(0), "defg")
+		eq(t, "wide rune cut by edge", c.row(1), ".xyz")
+		eq(t, "short line", c.row(2), "....")
+	})
+}
+
+func TestTabStops(t *testing.T) {
+	eq(t, "tab at line start", DisplayColumn("\tx", 1), 4)
+	eq(t, "tab reaches next stop", DisplayColumn("ab\tx", 3), 4)
+	eq(t, "tab at a stop is a full width", DisplayColumn("abcd\tx", 5), 8)
+	eq(t, "inside a tab", ColumnAt("ab\tx", 3), 2)
+	eq(t, "after a tab", ColumnAt("ab\tx", 4), 3)
+	eq(t, "retab", Retab("  \t      x\ty", 4), "\t\t  x\ty")
+	eq(t, "retab to wider stops", Retab("  \t      x\ty", 8), "\t      x\ty")
+	saved := screen.TabWidth
+	defer func() { screen.TabWidth = saved }()
+	screen.TabWidth = 8
+	eq(t, "wider stops", DisplayColumn("ab\tx", 3), 8)
+	c := newCellCanvas(6, 1)
+	putLine(c, 0, "a\tb", 5)
+	eq(t, "tab cut by left edge", c.row(0), "   b..")
+}
@@ -0,0 +1,78 @@
+package text
+
+import "fmt"
+
+// diffLimit bounds the work Diff does matching up changed lines; past
+// it a changed region is shown as all removed and all added.
+const diffLimit = 1 << 20
+
+// Diff returns the differences between the lines old and new as the
+// hunks of a unified diff without context: each hunk is a header
+// giving the lines changed, counted from 1, followed by the old lines
+// marked - and the new lines marked +.
+func Diff(old, new []string) []string {
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix += 1
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix += 1
+	}
+	a, b := old[prefix:len(old)-suffix], new[prefix:len(new)-suffix]
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a)*len(b) > diffLimit {
+		return hunk(nil, a, b, prefix, prefix)
+	}
+	// common[i][j] is the length of the longest common subsequence
+	// of a[i:] and b[j:].
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i -= 1 {
+		for j := len(b) - 1; j >= 0; j -= 1 {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	result := []string{}
+	i, j, fromI, fromJ := 0, 0, 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			result = hunk(result, a[fromI:i], b[fromJ:j], prefix+fromI, prefix+fromJ)
+			i, j = i+1, j+1
+			fromI, fromJ = i, j
+		case j == len(b) || i < len(a) && common[i+1][j] >= common[i][j+1]:
+			i += 1
+		default:
+			j += 1
+		}
+	}
+	return hunk(result, a[fromI:], b[fromJ:], prefix+fromI, prefix+fromJ)
+}
+
+// hunk appends to result the hunk replacing lines old, at index oldAt
+// of the old text, by lines new, at index newAt of the new text, if
+// there are any.
+func hunk(result, old, new []string, oldAt, newAt int) []string {
+	if len(old) == 0 && len(new) == 0 {
+		return result
+	}
+	result = append(result, fmt.Sprintf("@@ -%v,%v +%v,%v @@", oldAt+1, len(old), newAt+1, len(new)))
+	for _, line := range old {
+		result = append(result, "-"+line)
+	}
+	for _, line := range new {
+		result = append(result, "+"+line)
+	}
+	return result
+}
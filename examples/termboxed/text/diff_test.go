@@ -0,0 +1,19 @@
+package text
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	check := func(oops, old, new, expected string) {
+		t.Helper()
+		eq(t, oops, strings.Join(Diff(strings.Fields(old), strings.Fields(new)), "|"), expected)
+	}
+	check("same", "a b c", "a b c", "")
+	check("changed line", "a b c", "a x c", "@@ -2,1 +2,1 @@|-b|+x")
+	check("added lines", "a c", "a b b c", "@@ -2,0 +2,2 @@|+b|+b")
+	check("removed at end", "a b c", "a", "@@ -2,2 +2,0 @@|-b|-c")
+	check("two hunks", "a b c d e", "a c d x e", "@@ -2,1 +2,0 @@|-b|@@ -5,0 +4,1 @@|+x")
+	check("from nothing", "", "a", "@@ -1,0 +1,1 @@|+a")
+}
@@ -0,0 +1,272 @@
+package text
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+// A BackupMode says what becomes of a file's previous content when a
+// buffer is written over it.
+type BackupMode int
+
+const (
+	NoBackup       BackupMode = iota // the previous content is lost
+	SimpleBackup                     // kept as name.bak, replacing any older one
+	NumberedBackup                   // kept as name.~N~ for the next unused N
+)
+
+// Backups is the backup mode used when writing files.
+var Backups = NoBackup
+
+// WriteConversion, if set, converts each line a buffer writes to the
+// named file; the buffer itself is left as it is.
+var WriteConversion func(fileName, line string) string
+
+// converted returns each with its lines converted for fileName by
+// WriteConversion.
+func converted(fileName string, each func(func(string)) error) func(func(string)) error {
+	if WriteConversion == nil {
+		return each
+	}
+	return func(f func(string)) error {
+		return each(func(line string) { f(WriteConversion(fileName, line)) })
+	}
+}
+
+// writeLines writes the lines that each produces to the named file
+// without ever leaving it partly written: the lines go to a temporary
+// file in the same directory which is synced and then renamed over the
+// original, keeping its permissions. A backup is made first if backups
+// asks for one. Nothing is written if each fails. It returns the stamp
+// of the file written.
+func writeLines(fileName string, backups BackupMode, each func(func(string)) error) (Stamp, error) {
+	if fileName == "" {
+		return Stamp{}, errors.New("no file name")
+	}
+	target, err := filepath.EvalSymlinks(fileName)
+	if os.IsNotExist(err) {
+		target, err = fileName, nil
+	}
+	if err != nil {
+		return Stamp{}, err
+	}
+	mode := os.FileMode(0666)
+	info, err := os.Stat(target)
+	exists := err == nil
+	if exists {
+		if !info.Mode().IsRegular() {
+			return Stamp{}, errors.New("not a regular file: " + fileName)
+		}
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return Stamp{}, err
+	}
+	dir, base := filepath.Split(target)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".*")
+	if err != nil {
+		return Stamp{}, err
+	}
+	sum, err := fillFile(f, mode, each)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return Stamp{}, err
+	}
+	if exists && backups != NoBackup {
+		if err := backup(target, backups); err != nil {
+			os.Remove(f.Name())
+			return Stamp{}, err
+		}
+	}
+	if err := os.Rename(f.Name(), target); err != nil {
+		os.Remove(f.Name())
+		return Stamp{}, err
+	}
+	syncDir(dir)
+	return stampOf(target, sum)
+}
+
+// readLines calls f with each line read from r, without its line
+// ending, and reports whether the last line had one. Unlike
+// bufio.Scanner it allows lines of any length.
+func readLines(r io.Reader, f func(string)) (ended bool, err error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			ended = strings.HasSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\n")
+			f(strings.TrimSuffix(line, "\r"))
+		}
+		if err == io.EOF {
+			return ended, nil
+		}
+		if err != nil {
+			return ended, err
+		}
+	}
+}
+
+// ReadLines returns the lines read from r, without their line endings.
+func ReadLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	_, err := readLines(r, func(line string) { lines = append(lines, line) })
+	return lines, err
+}
+
+// splicing works out how to splice lines read from a file into b at
+// where: lines [low, high) of b are to be replaced by the returned
+// lines, after which the text read ends at end. If where is within
+// b the text is spliced in at that column, the last line read being
+// joined to the rest of the line unless it ended with a line ending.
+// Otherwise the lines are added to the end of b.
+func splicing(b Buffer, where grid.LineCol, read []string, ended bool) (low, high int, lines []string, end grid.LineCol) {
+	n := b.LineCount()
+	if len(read) == 0 && where.Line < n {
+		return n, n, nil, where
+	}
+	if where.Line >= n || len(read) == 0 {
+		return n, n, read, grid.LineCol{Line: n + len(read)}
+	}
+	if ended {
+		read = append(read, "")
+	}
+	before, after := splitLine(padLine(b.Line(where.Line), where.Col), where.Col)
+	last := len(read) - 1
+	end = grid.LineCol{Line: where.Line + last, Col: RuneCount(read[last])}
+	if last == 0 {
+		end.Col += where.Col
+	}
+	lines = append([]string{before + read[0]}, read[1:]...)
+	lines[last] += after
+	return where.Line, where.Line + 1, lines, end
+}
+
+// WriteLinesToFile safely replaces the named file with lines, as
+// WriteToFile does with a whole buffer.
+func WriteLinesToFile(fileName string, lines []string) error {
+	_, err := writeLines(fileName, Backups, eachOf(lines))
+	return err
+}
+
+// WriteLinesWithoutBackup is WriteLinesToFile for files the editor
+// keeps for itself, such as the command history, which are never
+// backed up whatever Backups says.
+func WriteLinesWithoutBackup(fileName string, lines []string) error {
+	_, err := writeLines(fileName, NoBackup, eachOf(lines))
+	return err
+}
+
+// AppendLinesToFile adds lines to the end of the named file, creating
+// it if need be.
+func AppendLinesToFile(fileName string, lines []string) error {
+	if fileName == "" {
+		return errors.New("no file name")
+	}
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := fillFile(f, info.Mode().Perm(), eachOf(lines)); err != nil {
+		f.Close()
+		return err
+	}
+	return nil
+}
+
+// eachOf returns a function giving lines to writeLines or fillFile.
+func eachOf(lines []string) func(func(string)) error {
+	return func(f func(string)) error {
+		for _, line := range lines {
+			f(line)
+		}
+		return nil
+	}
+}
+
+// fillFile writes the lines to f, gives it mode, and syncs and
+// closes it. It returns the hash of what it wrote.
+func fillFile(f *os.File, mode os.FileMode, each func(func(string)) error) ([]byte, error) {
+	h := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, h))
+	err := each(func(line string) {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), f.Close()
+}
+
+// backup keeps a copy of the named file as mode says.
+func backup(fileName string, mode BackupMode) error {
+	name := fileName + ".bak"
+	if mode == NumberedBackup {
+		for n := 1; ; n += 1 {
+			name = fmt.Sprintf("%v.~%v~", fileName, n)
+			if _, err := os.Lstat(name); os.IsNotExist(err) {
+				break
+			}
+		}
+	}
+	os.Remove(name)
+	if os.Link(fileName, name) == nil {
+		return nil
+	}
+	return copyFile(fileName, name)
+}
+
+// copyFile copies the file from to a new file to.
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir makes a rename in dir durable, where the system allows.
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
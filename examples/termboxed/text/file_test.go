@@ -0,0 +1,159 @@
+package text
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	bytes, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes)
+}
+
+func TestWriteToFile(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		saved := Backups
+		defer func() { Backups = saved }()
+		dir := t.TempDir()
+		name := filepath.Join(dir, "f")
+		os.WriteFile(name, []byte("old\n"), 0640)
+		load(t, b, "one\ntwo\n")
+
+		eq(t, "no name known", b.WriteToFile(nil) != nil, true)
+		if err := b.WriteToFile([]string{name}); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "content written", readFile(t, name), "one\ntwo\n")
+		info, _ := os.Stat(name)
+		eq(t, "mode kept", info.Mode().Perm(), os.FileMode(0640))
+
+		Backups = SimpleBackup
+		b.Insert(grid.LineCol{}, 'x')
+		if err := b.WriteToFile(nil); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "name remembered", readFile(t, name), "xone\ntwo\n")
+		eq(t, "simple backup", readFile(t, name+".bak"), "one\ntwo\n")
+
+		Backups = NumberedBackup
+		b.WriteToFile(nil)
+		b.WriteToFile(nil)
+		eq(t, "first numbered backup", readFile(t, name+".~1~"), "xone\ntwo\n")
+		eq(t, "second numbered backup", readFile(t, name+".~2~"), "xone\ntwo\n")
+
+		entries, _ := os.ReadDir(dir)
+		eq(t, "no temporary files left", len(entries), 4)
+		if err := WriteLinesWithoutBackup(name, []string{"kept"}); err != nil {
+			t.Fatal(err)
+		}
+		entries, _ = os.ReadDir(dir)
+		eq(t, "written without backup", len(entries), 4)
+		eq(t, "lines written", readFile(t, name), "kept\n")
+		eq(t, "missing directory", b.WriteToFile([]string{filepath.Join(dir, "no", "f")}) != nil, true)
+	})
+}
+
+func TestWriteRelativeName(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		dir := t.TempDir()
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+		// a temporary file made anywhere but beside f fails
+		t.Setenv("TMPDIR", filepath.Join(dir, "missing"))
+		load(t, b, "one\n")
+		if err := b.WriteToFile([]string{"f"}); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "written beside it", readFile(t, filepath.Join(dir, "f")), "one\n")
+	})
+}
+
+func TestWriteConversion(t *testing.T) {
+	defer func() { WriteConversion = nil }()
+	WriteConversion = func(fileName, line string) string { return filepath.Base(fileName) + ":" + line }
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		load(t, b, "one\ntwo\n")
+		name := filepath.Join(t.TempDir(), "f")
+		if err := b.WriteToFile([]string{name}); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "lines converted", readFile(t, name), "f:one\nf:two\n")
+		eq(t, "buffer left alone", content(b), "one|two")
+	})
+}
+
+func TestModified(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		eq(t, "new buffer", b.Modified(), false)
+		load(t, b, "one\n")
+		eq(t, "read into empty buffer", b.Modified(), false)
+		generation := b.Generation()
+		b.Insert(grid.LineCol{}, 'x')
+		eq(t, "after insert", b.Modified(), true)
+		eq(t, "generation moves on", b.Generation() > generation, true)
+		name := filepath.Join(t.TempDir(), "f")
+		if err := b.WriteToFile([]string{name}); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "after write", b.Modified(), false)
+		eq(t, "name kept", b.FileName(), name)
+		b.Insert(grid.LineCol{}, 'y')
+		if err := b.WriteToFile([]string{name + ".copy"}); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "after writing a copy", b.Modified(), true)
+		eq(t, "name not taken from copy", b.FileName(), name)
+		load(t, b, "two\n")
+		eq(t, "read into non-empty buffer", b.Modified(), true)
+	})
+}
+
+func TestChangedOnDisk(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		name := filepath.Join(t.TempDir(), "f")
+		os.WriteFile(name, []byte("one\n"), 0666)
+		f, _ := os.Open(name)
+		b.ReadFromFile(grid.LineCol{}, name, f)
+		f.Close()
+		_, changed, err := ChangedOnDisk(b)
+		eq(t, "just read", changed, false)
+		eq(t, "no error", err, nil)
+
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(name, later, later)
+		_, changed, _ = ChangedOnDisk(b)
+		eq(t, "touched but same content", changed, false)
+
+		os.WriteFile(name, []byte("two\n"), 0666)
+		os.Chtimes(name, later.Add(time.Minute), later.Add(time.Minute))
+		_, changed, _ = ChangedOnDisk(b)
+		eq(t, "rewritten", changed, true)
+
+		b.WriteToFile(nil)
+		_, changed, _ = ChangedOnDisk(b)
+		eq(t, "after our own write", changed, false)
+
+		b.Insert(grid.LineCol{}, 'x')
+		b.WriteToFile([]string{name + ".copy"})
+		_, changed, _ = ChangedOnDisk(b)
+		eq(t, "after writing a copy", changed, false)
+
+		os.Remove(name)
+		_, changed, _ = ChangedOnDisk(b)
+		eq(t, "removed", changed, false)
+	})
+}
@@ -0,0 +1,278 @@
+package text
+
+import (
+	"io"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+// A Place is the editing position that undo and redo restore along
+// with the text.
+type Place struct {
+	Where       grid.LineCol
+	First, Last int // the marked range, or -1, -1 if there is none
+}
+
+// Journal is a Buffer that records every change made through it so
+// that changes can be undone and redone. Changes are grouped into
+// steps: a step is begun by Begin and everything done until the next
+// Begin is undone or redone as a whole. Execute is not recorded;
+// commands that it runs should make their changes through the journal.
+type Journal struct {
+	Buffer
+
+	done    []*step // steps that can be undone, most recent last
+	undone  []*step // steps that can be redone, most recent last
+	current *step   // the step collecting changes, if any
+
+	// where the buffer last matched its file: the latest step then and
+	// how many edits it had, or -1 edits if that is not known
+	saved      *step
+	savedEdits int
+}
+
+type step struct {
+	kind          string
+	edits         []edit
+	before, after Place
+}
+
+// edit records that lines [low, low+len(old)) were replaced by new,
+// or, if before is not nil, that the whole content of the buffer went
+// from before to after.
+type edit struct {
+	low           int
+	old, new      []string
+	before, after interface{}
+}
+
+// A snapshotter is a Buffer whose whole content can be kept and put
+// back without reading its lines, which for an indexed file would
+// load all of them.
+type snapshotter interface {
+	snapshot() interface{}
+	restore(content interface{})
+}
+
+// NewJournal returns a Journal recording changes made to b.
+func NewJournal(b Buffer) *Journal {
+	j := &Journal{Buffer: b}
+	if b.Modified() {
+		j.savedEdits = -1
+	}
+	return j
+}
+
+// A savedMatcher is a Buffer that can be told it matches its file
+// again, as when changes since it was saved are undone.
+type savedMatcher interface {
+	matchSaved()
+}
+
+// latest returns the step holding the most recent change and how many
+// edits it has, or nil, 0 if nothing is recorded.
+func (j *Journal) latest() (*step, int) {
+	if j.current != nil && len(j.current.edits) > 0 {
+		return j.current, len(j.current.edits)
+	}
+	if n := len(j.done); n > 0 {
+		return j.done[n-1], len(j.done[n-1].edits)
+	}
+	return nil, 0
+}
+
+// noteSaved remembers where the journal is if the buffer matches its
+// file.
+func (j *Journal) noteSaved() {
+	if !j.Buffer.Modified() {
+		j.saved, j.savedEdits = j.latest()
+	}
+}
+
+// backToSaved tells the buffer if undo or redo has brought it back to
+// where it matched its file.
+func (j *Journal) backToSaved() {
+	if s, n := j.latest(); s == j.saved && n == j.savedEdits {
+		if m, ok := j.Buffer.(savedMatcher); ok {
+			m.matchSaved()
+		}
+	}
+}
+
+func (j *Journal) WriteToFile(fileNameOption []string) error {
+	err := j.Buffer.WriteToFile(fileNameOption)
+	j.noteSaved()
+	return err
+}
+
+// Begin starts a new step at the given place. If kind is not empty
+// and the current step was begun with the same kind, the current step
+// continues instead; this is how runs of typing become a single step.
+func (j *Journal) Begin(kind string, at Place) {
+	if j.current != nil {
+		if kind != "" && kind == j.current.kind {
+			return
+		}
+		j.finish(at)
+	}
+	j.current = &step{kind: kind, before: at}
+}
+
+// finish closes the current step, keeping it only if it changed
+// something.
+func (j *Journal) finish(at Place) {
+	if j.current != nil && len(j.current.edits) > 0 {
+		j.current.after = at
+		j.done = append(j.done, j.current)
+	}
+	j.current = nil
+}
+
+// Undo reverses the most recent step, returning the place at which
+// that step began. It returns false if there is nothing to undo.
+func (j *Journal) Undo(at Place) (Place, bool) {
+	j.finish(at)
+	if len(j.done) == 0 {
+		return at, false
+	}
+	s := j.done[len(j.done)-1]
+	j.done = j.done[:len(j.done)-1]
+	for i := len(s.edits) - 1; i >= 0; i -= 1 {
+		j.apply(s.edits[i], true)
+	}
+	j.undone = append(j.undone, s)
+	j.backToSaved()
+	return s.before, true
+}
+
+// Redo repeats the most recently undone step, returning the place
+// at which that step ended. It returns false if there is nothing
+// to redo.
+func (j *Journal) Redo(at Place) (Place, bool) {
+	j.finish(at)
+	if len(j.undone) == 0 {
+		return at, false
+	}
+	s := j.undone[len(j.undone)-1]
+	j.undone = j.undone[:len(j.undone)-1]
+	for _, e := range s.edits {
+		j.apply(e, false)
+	}
+	j.done = append(j.done, s)
+	j.backToSaved()
+	return s.after, true
+}
+
+// apply makes the buffer as e left it, or as e found it if back is set.
+func (j *Journal) apply(e edit, back bool) {
+	switch {
+	case e.before != nil && back:
+		j.Buffer.(snapshotter).restore(e.before)
+	case e.before != nil:
+		j.Buffer.(snapshotter).restore(e.after)
+	case back:
+		j.Buffer.ReplaceLines(e.low, e.low+len(e.new), e.old)
+	default:
+		j.Buffer.ReplaceLines(e.low, e.low+len(e.old), e.new)
+	}
+}
+
+// lines returns a copy of lines [low, high) of the underlying buffer.
+func (j *Journal) lines(low, high int) []string {
+	result := make([]string, 0, high-low)
+	for i := low; i < high; i += 1 {
+		result = append(result, j.Buffer.Line(i))
+	}
+	return result
+}
+
+// change runs f, which may alter only lines [low, high) of the buffer
+// and add lines to its end, and records what it did. A change to the
+// whole of a buffer that can be snapshot is recorded as the content
+// before and after rather than as copies of the lines.
+func (j *Journal) change(low, high int, f func()) {
+	defer j.noteSaved()
+	n := j.Buffer.LineCount()
+	low, high = bounds.Min(low, n), bounds.Min(high, n)
+	if s, ok := j.Buffer.(snapshotter); ok && low == 0 && high == n {
+		before := s.snapshot()
+		f()
+		if after := s.snapshot(); after != before {
+			j.record(edit{before: before, after: after})
+		}
+		return
+	}
+	old := j.lines(low, high)
+	f()
+	high += j.Buffer.LineCount() - n
+	changed := j.lines(low, high)
+	if !sameLines(old, changed) {
+		j.record(edit{low: low, old: old, new: changed})
+	}
+}
+
+// record adds e to the current step.
+func (j *Journal) record(e edit) {
+	if j.current == nil {
+		j.current = &step{}
+	}
+	j.current.edits = append(j.current.edits, e)
+	j.undone = nil
+}
+
+func sameLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (j *Journal) Insert(where grid.LineCol, ch rune) {
+	j.change(where.Line, where.Line+1, func() { j.Buffer.Insert(where, ch) })
+}
+
+func (j *Journal) DeleteLine(where grid.LineCol) (result grid.LineCol) {
+	j.change(where.Line, where.Line+1, func() { result = j.Buffer.DeleteLine(where) })
+	return result
+}
+
+func (j *Journal) MoveLines(where grid.LineCol, firstLine, lastLine int) {
+	low := bounds.Min(firstLine, where.Line+1)
+	high := bounds.Max(lastLine+1, where.Line+1)
+	j.change(low, high, func() { j.Buffer.MoveLines(where, firstLine, lastLine) })
+}
+
+func (j *Journal) ReplaceLines(low, high int, lines []string) {
+	j.change(low, high, func() { j.Buffer.ReplaceLines(low, high, lines) })
+}
+
+func (j *Journal) DeleteLines(where grid.LineCol, lowLine, highLine int) (result grid.LineCol) {
+	j.change(lowLine, highLine+1, func() { result = j.Buffer.DeleteLines(where, lowLine, highLine) })
+	return result
+}
+
+func (j *Journal) DeleteBack(where grid.LineCol) (result grid.LineCol) {
+	j.change(bounds.Max(where.Line-1, 0), where.Line+1, func() { result = j.Buffer.DeleteBack(where) })
+	return result
+}
+
+func (j *Journal) DeleteForward(where grid.LineCol) (result grid.LineCol) {
+	j.change(where.Line, where.Line+1, func() { result = j.Buffer.DeleteForward(where) })
+	return result
+}
+
+func (j *Journal) Return(where grid.LineCol) (result grid.LineCol) {
+	j.change(where.Line, where.Line+1, func() { result = j.Buffer.Return(where) })
+	return result
+}
+
+func (j *Journal) ReadFromFile(where grid.LineCol, fileName string, r io.Reader) (result grid.LineCol, err error) {
+	j.change(where.Line, where.Line+1, func() { result, err = j.Buffer.ReadFromFile(where, fileName, r) })
+	return result, err
+}
@@ -0,0 +1,112 @@
+package text
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+func TestUndoRedoEveryChange(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		j := NewJournal(b)
+		load(t, j, "0\n1\n2\n3\n")
+		changes := []func(){
+			func() { j.Insert(grid.LineCol{Line: 1, Col: 1}, 'x') },
+			func() { j.Insert(grid.LineCol{Line: 7, Col: 2}, 'y') },
+			func() { j.Return(grid.LineCol{Line: 1, Col: 1}) },
+			func() { j.DeleteBack(grid.LineCol{Line: 2, Col: 1}) },
+			func() { j.DeleteForward(grid.LineCol{Line: 0, Col: 0}) },
+			func() { j.DeleteLine(grid.LineCol{Line: 3}) },
+			func() { j.DeleteLines(grid.LineCol{}, 1, 2) },
+			func() { j.MoveLines(grid.LineCol{Line: 0}, 2, 3) },
+			func() { j.MoveLines(grid.LineCol{Line: 4}, 0, 1) },
+			func() { j.ReplaceLines(1, 2, []string{"a", "b", "c"}) },
+		}
+		history := []string{content(j)}
+		for i, change := range changes {
+			j.Begin("", Place{Where: grid.LineCol{Line: i}})
+			change()
+			history = append(history, content(j))
+		}
+		for i := len(changes) - 1; i >= 0; i -= 1 {
+			place, ok := j.Undo(Place{})
+			eq(t, "undo possible", ok, true)
+			eq(t, "content after undo", content(j), history[i])
+			eq(t, "place after undo", place.Where.Line, i)
+		}
+		for i := range changes {
+			_, ok := j.Redo(Place{})
+			eq(t, "redo possible", ok, true)
+			eq(t, "content after redo", content(j), history[i+1])
+		}
+	})
+}
+
+func TestTypingIsOneStep(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		j := NewJournal(b)
+		where := grid.LineCol{}
+		for _, ch := range "abc" {
+			j.Begin("typing", Place{Where: where})
+			j.Insert(where, ch)
+			where.RightOne()
+		}
+		j.Begin("", Place{Where: where})
+		where = j.Return(where)
+		eq(t, "content", content(j), "abc|")
+
+		_, ok := j.Undo(Place{Where: where})
+		eq(t, "undo return", ok, true)
+		eq(t, "content after undoing return", content(j), "abc")
+		place, _ := j.Undo(Place{})
+		eq(t, "content after undoing typing", content(j), "")
+		eq(t, "place after undoing typing", place.Where, grid.LineCol{})
+		_, ok = j.Undo(Place{})
+		eq(t, "nothing left to undo", ok, false)
+	})
+}
+
+func TestChangeDiscardsRedo(t *testing.T) {
+	j := NewJournal(NewBuffer(execNothing))
+	j.Begin("", Place{})
+	j.Insert(grid.LineCol{}, 'a')
+	j.Undo(Place{})
+	j.Begin("", Place{})
+	j.Insert(grid.LineCol{}, 'b')
+	_, ok := j.Redo(Place{})
+	eq(t, "redo after new change", ok, false)
+	eq(t, "content", content(j), "b")
+}
+
+func TestUndoToSaved(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		j := NewJournal(b)
+		load(t, j, "one\n")
+		j.Begin("", Place{})
+		j.Insert(grid.LineCol{}, 'x')
+		eq(t, "after insert", j.Modified(), true)
+		j.Undo(Place{})
+		eq(t, "undone to the text read", j.Modified(), false)
+		j.Redo(Place{})
+		eq(t, "redone", j.Modified(), true)
+
+		name := filepath.Join(t.TempDir(), "f")
+		if err := j.WriteToFile([]string{name}); err != nil {
+			t.Fatal(err)
+		}
+		j.Undo(Place{})
+		eq(t, "undone past the save", j.Modified(), true)
+		j.Redo(Place{})
+		eq(t, "redone to the save", j.Modified(), false)
+
+		j.Begin("", Place{})
+		j.Insert(grid.LineCol{}, 'y')
+		j.Begin("", Place{})
+		j.Insert(grid.LineCol{}, 'z')
+		j.Undo(Place{})
+		eq(t, "undone partway", j.Modified(), true)
+		j.Undo(Place{})
+		eq(t, "undone to the save", j.Modified(), false)
+	})
+}
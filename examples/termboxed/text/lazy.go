@@ -0,0 +1,138 @@
+package text
+
+import (
+	"bufio"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// LazyThreshold is the size in bytes from which a file read into a
+// RopeBuffer is indexed rather than loaded: the buffer records where
+// each run of lines starts and reads them only when they are needed.
+var LazyThreshold int64 = 64 << 20
+
+// maxLoaded is the number of segments a source keeps loaded at once;
+// the least recently loaded is dropped to make room for another.
+const maxLoaded = 256
+
+// A source is a file that lazy rope leaves read their lines from. It
+// stays open for as long as any leaf refers to it; the file is closed
+// when the source is collected.
+type source struct {
+	file   *os.File
+	loaded []*segment // segments holding their lines, oldest first
+	err    *error     // where to keep the first error reading the file
+}
+
+// A segment is a run of lines of a source that a leaf holds in place
+// of the lines themselves until they are wanted.
+type segment struct {
+	source *source
+	offset int64    // where the lines start in the file
+	length int64    // their length in bytes, line endings included
+	count  int      // the number of lines
+	lines  []string // the lines, while loaded
+}
+
+// load returns the lines of s, reading them if they are not loaded.
+// If they cannot be read they are returned empty and the error is
+// kept where the source says.
+func (s *segment) load() []string {
+	if s.lines != nil {
+		return s.lines
+	}
+	src := s.source
+	data := make([]byte, s.length)
+	_, err := src.file.ReadAt(data, s.offset)
+	lines := []string{}
+	if err == nil {
+		_, err = readLines(strings.NewReader(string(data)), func(line string) { lines = append(lines, line) })
+	}
+	if err == nil && len(lines) != s.count {
+		err = errors.New(src.file.Name() + " changed while being edited")
+	}
+	if err != nil {
+		if *src.err == nil {
+			*src.err = err
+		}
+		lines = make([]string, s.count)
+	}
+	s.lines = lines[:s.count:s.count]
+	if len(src.loaded) == maxLoaded {
+		src.loaded[0].lines = nil
+		src.loaded = src.loaded[1:]
+	}
+	src.loaded = append(src.loaded, s)
+	return s.lines
+}
+
+// lazyFile returns r as a file if it is one big enough to index.
+func lazyFile(r io.Reader) (*os.File, bool) {
+	f, ok := r.(*os.File)
+	if !ok || LazyThreshold <= 0 {
+		return nil, false
+	}
+	info, err := f.Stat()
+	return f, err == nil && info.Mode().IsRegular() && info.Size() >= LazyThreshold
+}
+
+// indexFile reads f, hashing it into h, and returns a rope of lazy
+// leaves for its lines. Errors in reading them later are kept in
+// failed.
+func indexFile(f *os.File, h hash.Hash, failed *error) (*rope, error) {
+	file, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	src := &source{file: file, err: failed}
+	leaves := []*rope{}
+	leaf := func(start, end int64, count int) {
+		s := &segment{source: src, offset: start, length: end - start, count: count}
+		leaves = append(leaves, &rope{lazy: s, count: count})
+	}
+	r := bufio.NewReaderSize(io.TeeReader(f, h), 1<<16)
+	// bytes [start, offset) of the file hold count lines, and the
+	// start of another if offset is past lineStart.
+	start, lineStart, offset, count := int64(0), int64(0), int64(0), 0
+	for {
+		chunk, err := r.ReadSlice('\n')
+		offset += int64(len(chunk))
+		switch err {
+		case nil:
+			count += 1
+			lineStart = offset
+			if count == maxLeaf {
+				leaf(start, offset, count)
+				start, count = offset, 0
+			}
+		case bufio.ErrBufferFull:
+			// part of a long line; keep going
+		case io.EOF:
+			if offset > lineStart {
+				count += 1
+			}
+			if count > 0 {
+				leaf(start, offset, count)
+			}
+			return ropeFromLeaves(leaves), nil
+		default:
+			file.Close()
+			return nil, err
+		}
+	}
+}
+
+// ropeFromLeaves builds a balanced rope from leaves in order.
+func ropeFromLeaves(leaves []*rope) *rope {
+	switch len(leaves) {
+	case 0:
+		return nil
+	case 1:
+		return leaves[0]
+	}
+	mid := len(leaves) / 2
+	return newNode(ropeFromLeaves(leaves[:mid]), ropeFromLeaves(leaves[mid:]))
+}
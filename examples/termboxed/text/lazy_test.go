@@ -0,0 +1,125 @@
+package text
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+// bigFile writes a file of n numbered lines, one of them very long,
+// with no newline at the end, and returns its name and lines.
+func bigFile(t *testing.T, n int) (string, []string) {
+	lines := numbered(n)
+	lines[n/2] = strings.Repeat("long ", 50000)
+	name := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "\n")), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return name, lines
+}
+
+func TestLongLines(t *testing.T) {
+	forEachBuffer(t, func(t *testing.T, b Buffer) {
+		name, lines := bigFile(t, 10)
+		f, _ := os.Open(name)
+		defer f.Close()
+		if _, err := b.ReadFromFile(grid.LineCol{}, name, f); err != nil {
+			t.Fatal(err)
+		}
+		eq(t, "line count", b.LineCount(), len(lines))
+		eq(t, "long line read whole", b.Line(5), lines[5])
+		eq(t, "last line", b.Line(9), "9")
+	})
+}
+
+func TestLazyLoading(t *testing.T) {
+	saved := LazyThreshold
+	defer func() { LazyThreshold = saved }()
+	LazyThreshold = 1
+	name, lines := bigFile(t, 100*maxLeaf+7)
+	b := NewBuffer(nil, WithRope()).(*RopeBuffer)
+	f, _ := os.Open(name)
+	if _, err := b.ReadFromFile(grid.LineCol{}, name, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	eq(t, "line count from index", b.LineCount(), len(lines))
+	eq(t, "not modified", b.Modified(), false)
+
+	c := newCellCanvas(8, 3)
+	b.PutLines(c, 1000, 3, 0)
+	eq(t, "lines shown", c.row(0)+"|"+c.row(2), "1000....|1002....")
+	loaded := 0
+	for _, s := range collectSegments(b.content) {
+		if s.lines != nil {
+			loaded += 1
+		}
+	}
+	eq(t, "only the segment shown is loaded", loaded, 1)
+
+	for i := range lines {
+		if b.Line(i) != lines[i] {
+			t.Fatalf("line %v: got %.20q, expected %.20q", i, b.Line(i), lines[i])
+		}
+	}
+	b.Insert(grid.LineCol{Line: 3, Col: 0}, 'x')
+	if err := b.WriteToFile(nil); err != nil {
+		t.Fatal(err)
+	}
+	lines[3] = "x" + lines[3]
+	bytes, _ := os.ReadFile(name)
+	eq(t, "written back", string(bytes), strings.Join(lines, "\n")+"\n")
+	eq(t, "lines still readable from the old file", b.Line(len(lines)-1), fmt.Sprint(len(lines)-1))
+}
+
+// collectSegments returns the segments of the lazy leaves of r.
+func collectSegments(r *rope) []*segment {
+	if r == nil {
+		return nil
+	}
+	if r.isLeaf() {
+		if r.lazy != nil {
+			return []*segment{r.lazy}
+		}
+		return nil
+	}
+	return append(collectSegments(r.left), collectSegments(r.right)...)
+}
+
+func TestLazyReloadJournalled(t *testing.T) {
+	saved := LazyThreshold
+	defer func() { LazyThreshold = saved }()
+	LazyThreshold = 1
+	name, lines := bigFile(t, 100*maxLeaf+7)
+	b := NewBuffer(nil, WithRope()).(*RopeBuffer)
+	j := NewJournal(b)
+	read := func() {
+		f, _ := os.Open(name)
+		defer f.Close()
+		if _, err := j.ReadFromFile(grid.LineCol{}, name, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read()
+	j.Begin("", Place{})
+	j.DeleteLines(grid.LineCol{}, 0, j.LineCount()-1)
+	read()
+	loaded := 0
+	for _, s := range collectSegments(b.content) {
+		if s.lines != nil {
+			loaded += 1
+		}
+	}
+	eq(t, "reload loads no segments", loaded, 0)
+	_, ok := j.Undo(Place{})
+	eq(t, "reload undone", ok, true)
+	eq(t, "lines after undo", j.LineCount(), len(lines))
+	_, ok = j.Redo(Place{})
+	eq(t, "reload redone", ok, true)
+	eq(t, "lines after redo", j.LineCount(), len(lines))
+	eq(t, "last line", j.Line(len(lines)-1), fmt.Sprint(len(lines)-1))
+}
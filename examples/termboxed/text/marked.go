@@ -0,0 +1,81 @@
+package text
+
+import "github.com/ehedgehog/guineapig/examples/termboxed/grid"
+
+// MarkedRange is a range of whole lines of a buffer. It is held by
+// a pair of anchors, one at the start of its first line and one at
+// the start of the line after its last, so it follows the lines it
+// marks as the buffer is edited.
+type MarkedRange struct {
+	buffer    Buffer
+	low, high *Anchor
+}
+
+// NewMarkedRange returns an inactive marked range on b.
+func NewMarkedRange(b Buffer) *MarkedRange {
+	return &MarkedRange{buffer: b}
+}
+
+// Buffer returns the buffer whose lines are marked.
+func (mr *MarkedRange) Buffer() Buffer {
+	return mr.buffer
+}
+
+// Range returns the first and last marked lines, or -1, -1 if the
+// range is not active.
+func (mr *MarkedRange) Range() (first, last int) {
+	if !mr.IsActive() {
+		return -1, -1
+	}
+	return mr.low.Line, mr.lastLine()
+}
+
+// lastLine is the line holding the last position before the high
+// anchor.
+func (mr *MarkedRange) lastLine() int {
+	if mr.high.Col == 0 {
+		return mr.high.Line - 1
+	}
+	return mr.high.Line
+}
+
+func (mr *MarkedRange) Clear() {
+	if mr.low != nil {
+		mr.low.Release()
+		mr.high.Release()
+		mr.low, mr.high = nil, nil
+	}
+}
+
+// IsActive is true if some lines are marked. A range all of whose
+// lines have been deleted is no longer active.
+func (mr *MarkedRange) IsActive() bool {
+	return mr.low != nil && mr.lastLine() >= mr.low.Line
+}
+
+// SetRange marks lines first to last inclusive.
+func (mr *MarkedRange) SetRange(first, last int) {
+	mr.Clear()
+	mr.low = mr.buffer.NewAnchor(grid.LineCol{Line: first}, MoveAfter)
+	mr.high = mr.buffer.NewAnchor(grid.LineCol{Line: last + 1}, StayBefore)
+}
+
+// SetLow makes lineNumber the first marked line, pushing the last
+// marked line down to it if necessary.
+func (mr *MarkedRange) SetLow(lineNumber int) {
+	first, last := mr.Range()
+	if first < 0 || last < lineNumber {
+		last = lineNumber
+	}
+	mr.SetRange(lineNumber, last)
+}
+
+// SetHigh makes lineNumber the last marked line, pulling the first
+// marked line up to it if necessary.
+func (mr *MarkedRange) SetHigh(lineNumber int) {
+	first, _ := mr.Range()
+	if first < 0 || first > lineNumber {
+		first = lineNumber
+	}
+	mr.SetRange(first, lineNumber)
+}
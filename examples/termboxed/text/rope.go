@@ -0,0 +1,192 @@
+package text
+
+import "github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+
+// rope is a persistent height-balanced tree of lines. Leaves hold
+// short runs of lines; interior nodes cache the line count and height
+// of their subtree so that indexing, splitting and joining are all
+// logarithmic in the number of lines. Nodes are never modified once
+// built, so a rope may be shared freely.
+type rope struct {
+	left, right *rope
+	lines       []string // leaf content; nil for interior nodes
+	lazy        *segment // where in a file the leaf content is, if not in lines
+	count       int      // number of lines in this subtree
+	height      int      // 0 for leaves
+}
+
+// maxLeaf is the largest number of lines that a leaf will hold when
+// ropes are built or merged. Splitting may leave smaller leaves.
+const maxLeaf = 64
+
+func newLeaf(lines []string) *rope {
+	return &rope{lines: lines, count: len(lines)}
+}
+
+func newNode(left, right *rope) *rope {
+	return &rope{
+		left:   left,
+		right:  right,
+		count:  left.count + right.count,
+		height: 1 + bounds.Max(left.height, right.height),
+	}
+}
+
+func (r *rope) isLeaf() bool {
+	return r.left == nil
+}
+
+// leafLines returns the lines of a leaf, reading them from its file
+// if need be.
+func (r *rope) leafLines() []string {
+	if r.lazy != nil {
+		return r.lazy.load()
+	}
+	return r.lines
+}
+
+func (r *rope) Len() int {
+	if r == nil {
+		return 0
+	}
+	return r.count
+}
+
+// ropeFromLines builds a balanced rope holding a copy of lines.
+func ropeFromLines(lines []string) *rope {
+	if len(lines) == 0 {
+		return nil
+	}
+	if len(lines) <= maxLeaf {
+		return newLeaf(append([]string(nil), lines...))
+	}
+	mid := len(lines) / 2
+	return newNode(ropeFromLines(lines[:mid]), ropeFromLines(lines[mid:]))
+}
+
+// Line returns line i, which must be in range.
+func (r *rope) Line(i int) string {
+	for !r.isLeaf() {
+		if i < r.left.count {
+			r = r.left
+		} else {
+			i -= r.left.count
+			r = r.right
+		}
+	}
+	return r.leafLines()[i]
+}
+
+// SetLine returns a rope like r but with line i replaced by s.
+// Only the path from the root to that line is copied.
+func (r *rope) SetLine(i int, s string) *rope {
+	if r.isLeaf() {
+		lines := append([]string(nil), r.leafLines()...)
+		lines[i] = s
+		return newLeaf(lines)
+	}
+	if i < r.left.count {
+		return newNode(r.left.SetLine(i, s), r.right)
+	}
+	return newNode(r.left, r.right.SetLine(i-r.left.count, s))
+}
+
+// Split returns a rope of the first i lines of r and a rope of
+// the remainder.
+func (r *rope) Split(i int) (*rope, *rope) {
+	if r == nil {
+		return nil, nil
+	}
+	if i <= 0 {
+		return nil, r
+	}
+	if i >= r.count {
+		return r, nil
+	}
+	if r.isLeaf() {
+		lines := r.leafLines()
+		return newLeaf(lines[:i:i]), newLeaf(lines[i:])
+	}
+	if i < r.left.count {
+		a, b := r.left.Split(i)
+		return a, join(b, r.right)
+	}
+	a, b := r.right.Split(i - r.left.count)
+	return join(r.left, a), b
+}
+
+// join concatenates two ropes, rebalancing as it goes.
+func join(a, b *rope) *rope {
+	if a.Len() == 0 {
+		return b
+	}
+	if b.Len() == 0 {
+		return a
+	}
+	if a.isLeaf() && b.isLeaf() && a.count+b.count <= maxLeaf {
+		lines := make([]string, 0, a.count+b.count)
+		return newLeaf(append(append(lines, a.leafLines()...), b.leafLines()...))
+	}
+	if a.height > b.height+1 {
+		return balance(a.left, join(a.right, b))
+	}
+	if b.height > a.height+1 {
+		return balance(join(a, b.left), b.right)
+	}
+	return newNode(a, b)
+}
+
+// balance builds a node from left and right, rotating if their
+// heights differ by more than one.
+func balance(left, right *rope) *rope {
+	if left.height > right.height+1 {
+		if left.left.height >= left.right.height {
+			return newNode(left.left, newNode(left.right, right))
+		}
+		lr := left.right
+		return newNode(newNode(left.left, lr.left), newNode(lr.right, right))
+	}
+	if right.height > left.height+1 {
+		if right.right.height >= right.left.height {
+			return newNode(newNode(left, right.left), right.right)
+		}
+		rl := right.left
+		return newNode(newNode(left, rl.left), newNode(rl.right, right.right))
+	}
+	return newNode(left, right)
+}
+
+// Splice returns a rope like r but with lines [low, high) replaced
+// by lines.
+func (r *rope) Splice(low, high int, lines []string) *rope {
+	before, rest := r.Split(low)
+	_, after := rest.Split(high - low)
+	return join(join(before, ropeFromLines(lines)), after)
+}
+
+// Slice returns a copy of lines [low, high) of r.
+func (r *rope) Slice(low, high int) []string {
+	result := make([]string, 0, high-low)
+	r.each(low, high, func(s string) { result = append(result, s) })
+	return result
+}
+
+// each calls f on each of the lines [low, high) of r in order.
+func (r *rope) each(low, high int, f func(string)) {
+	if r == nil || low >= high {
+		return
+	}
+	if r.isLeaf() {
+		for _, s := range r.leafLines()[bounds.Max(low, 0):bounds.Min(high, r.count)] {
+			f(s)
+		}
+		return
+	}
+	n := r.left.count
+	if low < n {
+		r.left.each(low, bounds.Min(high, n), f)
+	}
+	if high > n {
+		r.right.each(bounds.Max(low-n, 0), high-n, f)
+	}
+}
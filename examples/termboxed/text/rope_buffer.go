@@ -0,0 +1,233 @@
+package text
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+	"github.com/ehedgehog/guineapig/examples/termboxed/screen"
+)
+
+// RopeBuffer is an implementation of Buffer that keeps its lines
+// in a rope, so that line insertion, deletion and movement cost
+// time logarithmic in the size of the buffer rather than linear.
+// Edits within a line still copy that line. Large files are indexed
+// rather than read, and their lines read as they are wanted.
+type RopeBuffer struct {
+	anchors
+	versions
+	content  *rope                      // existing lines of text
+	execute  func(Buffer, string) error // execute command on buffer at line
+	fileName string                     // file name used for most recent read
+	readErr  error                      // why lines of a large file could not be read
+}
+
+// Expose copies the entire content of the buffer; prefer Line.
+func (b *RopeBuffer) Expose() []string {
+	return b.content.Slice(0, b.content.Len())
+}
+
+func (b *RopeBuffer) LineCount() int {
+	return b.content.Len()
+}
+
+func (b *RopeBuffer) Line(n int) string {
+	return b.content.Line(n)
+}
+
+func (b *RopeBuffer) MoveLines(where grid.LineCol, firstLine, lastLine int) {
+	target := where.Line
+	if firstLine <= target && target <= lastLine {
+		panic("target within range")
+	}
+	if target < firstLine {
+		before, tail := b.content.Split(target + 1)
+		between, tail := tail.Split(firstLine - target - 1)
+		moved, after := tail.Split(lastLine - firstLine + 1)
+		b.content = join(join(join(before, moved), between), after)
+	} else {
+		before, tail := b.content.Split(firstLine)
+		moved, tail := tail.Split(lastLine - firstLine + 1)
+		between, after := tail.Split(target - lastLine)
+		b.content = join(join(join(before, between), moved), after)
+	}
+	b.linesMoved(firstLine, lastLine, target)
+	b.changed()
+}
+
+func (b *RopeBuffer) ReplaceLines(low, high int, lines []string) {
+	b.content = b.content.Splice(low, high, lines)
+	b.linesReplaced(low, high, len(lines))
+	b.changed()
+}
+
+func (b *RopeBuffer) DeleteLines(where grid.LineCol, lowLine, highLine int) grid.LineCol {
+	if 0 <= lowLine && lowLine <= highLine && highLine < b.content.Len() {
+		b.content = b.content.Splice(lowLine, highLine+1, nil)
+		b.linesReplaced(lowLine, highLine+1, 0)
+		b.changed()
+		if where.Line >= lowLine {
+			if where.Line <= highLine {
+				where.Line = lowLine
+			} else {
+				where.Line = where.Line - (highLine - lowLine + 1)
+			}
+		}
+	}
+	return where
+}
+
+func (b *RopeBuffer) DeleteLine(where grid.LineCol) grid.LineCol {
+	line := where.Line
+	if line < b.content.Len() {
+		b.content = b.content.Splice(line, line+1, nil)
+		b.linesReplaced(line, line+1, 0)
+		b.changed()
+	} else {
+		// nothing to do -- deleting virtual line
+	}
+	return where
+}
+
+func (b *RopeBuffer) snapshot() interface{} {
+	return b.content
+}
+
+func (b *RopeBuffer) restore(content interface{}) {
+	n := b.content.Len()
+	b.content = content.(*rope)
+	b.linesReplaced(0, n, b.content.Len())
+	b.changed()
+}
+
+func (b *RopeBuffer) FileName() string {
+	return b.fileName
+}
+
+func (b *RopeBuffer) WriteToFile(fileNameOption []string) error {
+	fileName := ""
+	if len(fileNameOption) > 0 {
+		fileName = fileNameOption[0]
+	}
+	if len(fileName) == 0 {
+		fileName = b.fileName
+	}
+	if b.readErr != nil {
+		return b.readErr
+	}
+	stamp, err := writeLines(fileName, Backups, converted(fileName, func(f func(string)) error {
+		b.content.each(0, b.content.Len(), f)
+		return b.readErr
+	}))
+	if err == nil && (b.fileName == "" || fileName == b.fileName) {
+		b.fileName = fileName
+		b.markSaved(stamp)
+	}
+	return err
+}
+
+func (b *RopeBuffer) ReadFromFile(where grid.LineCol, fileName string, r io.Reader) (grid.LineCol, error) {
+	n := b.content.Len()
+	h := sha256.New()
+	var err error
+	end := grid.LineCol{Line: n}
+	if f, ok := lazyFile(r); ok && n == 0 {
+		var more *rope
+		more, err = indexFile(f, h, &b.readErr)
+		b.content = more
+		b.linesReplaced(0, 0, more.Len())
+		end.Line = more.Len()
+	} else {
+		read := []string{}
+		var ended bool
+		ended, err = readLines(io.TeeReader(r, h), func(line string) { read = append(read, line) })
+		var low, high int
+		var lines []string
+		low, high, lines, end = splicing(b, where, read, ended)
+		b.content = b.content.Splice(low, high, lines)
+		if low == high {
+			b.linesReplaced(low, high, len(lines))
+		} else {
+			b.textSpliced(where, end)
+		}
+	}
+	b.changed()
+	if n == 0 {
+		b.fileName = fileName
+		if err == nil {
+			b.markSaved(readStamp(fileName, h))
+		}
+	}
+	return end, err
+}
+
+func (b *RopeBuffer) makeRoom(where grid.LineCol) {
+	line, col := where.Line, where.Col
+	if n := b.content.Len(); line >= n {
+		b.content = join(b.content, ropeFromLines(make([]string, line+1-n)))
+	}
+	if content := b.content.Line(line); col > RuneCount(content) {
+		b.content = b.content.SetLine(line, padLine(content, col))
+	}
+}
+
+func (b *RopeBuffer) Insert(where grid.LineCol, ch rune) {
+	b.makeRoom(where)
+	line := where.Line
+	b.content = b.content.SetLine(line, insertRune(b.content.Line(line), where.Col, ch))
+	b.textInserted(where, 1)
+	b.changed()
+}
+
+func (b *RopeBuffer) Execute(where grid.LineCol) (grid.LineCol, error) {
+	b.makeRoom(where)
+	return where, b.execute(b, b.content.Line(where.Line))
+}
+
+func (b *RopeBuffer) Return(where grid.LineCol) grid.LineCol {
+	b.makeRoom(where)
+
+	line, col := where.Line, where.Col
+	left, right := splitLine(b.content.Line(line), col)
+
+	b.content = b.content.Splice(line, line+1, []string{left, right})
+	b.lineSplit(where)
+	b.changed()
+	where.DownOne()
+	where.Col = 0
+	return where
+}
+
+func (b *RopeBuffer) DeleteBack(where grid.LineCol) grid.LineCol {
+	b.makeRoom(where)
+	line, col := where.Line, where.Col
+	if col > 0 {
+		b.content = b.content.SetLine(line, deleteRune(b.content.Line(line), col-1))
+		where.LeftOne()
+		b.textDeleted(where, 1)
+		b.changed()
+	} else if line > 0 {
+		previous := b.content.Line(line - 1)
+		b.content = b.content.Splice(line-1, line+1, []string{previous + b.content.Line(line)})
+		where = grid.LineCol{Line: line - 1, Col: RuneCount(previous)}
+		b.linesJoined(line-1, where.Col)
+		b.changed()
+	}
+	return where
+}
+
+func (b *RopeBuffer) DeleteForward(where grid.LineCol) grid.LineCol {
+	where.RightOne()
+	return b.DeleteBack(where)
+}
+
+func (b *RopeBuffer) PutLines(w screen.Canvas, first, n, left int) {
+	if first < 0 {
+		return
+	}
+	row := 0
+	b.content.each(first, first+n, func(line string) {
+		putLine(w, row, line, left)
+		row += 1
+	})
+}
@@ -0,0 +1,102 @@
+package text
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+func numbered(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i)
+	}
+	return lines
+}
+
+func bytesOfLines(n int) io.Reader {
+	return strings.NewReader(strings.Join(numbered(n), "\n") + "\n")
+}
+
+// checkRope verifies the cached counts and heights of r and that no
+// node is more than one level out of balance.
+func checkRope(t *testing.T, r *rope) {
+	t.Helper()
+	if r == nil || r.isLeaf() {
+		return
+	}
+	checkRope(t, r.left)
+	checkRope(t, r.right)
+	if r.count != r.left.Len()+r.right.Len() {
+		t.Fatalf("count %v, expected %v", r.count, r.left.Len()+r.right.Len())
+	}
+	diff := r.left.height - r.right.height
+	if diff < -1 || diff > 1 {
+		t.Fatalf("unbalanced node: heights %v and %v", r.left.height, r.right.height)
+	}
+}
+
+func TestRopeMatchesSlice(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	model := numbered(1000)
+	r := ropeFromLines(model)
+	for step := 0; step < 2000; step += 1 {
+		low := random.Intn(len(model) + 1)
+		high := low + random.Intn(len(model)-low+1)
+		insert := numbered(random.Intn(2 * maxLeaf))
+		r = r.Splice(low, high, insert)
+		model = append(append(append([]string{}, model[:low]...), insert...), model[high:]...)
+		if i := random.Intn(len(model) + 1); i < len(model) {
+			r = r.SetLine(i, "changed")
+			model[i] = "changed"
+		}
+		checkRope(t, r)
+		if r.Len() != len(model) {
+			t.Fatalf("step %v: rope has %v lines, expected %v", step, r.Len(), len(model))
+		}
+	}
+	for i, line := range r.Slice(0, r.Len()) {
+		if line != model[i] || r.Line(i) != model[i] {
+			t.Fatalf("line %v: got %q, expected %q", i, line, model[i])
+		}
+	}
+}
+
+func benchmarkBuffers(b *testing.B, edit func(buf Buffer, size, i int)) {
+	for _, kind := range buffers {
+		for _, size := range []int{1000, 100000} {
+			b.Run(fmt.Sprintf("%s/%d", kind.name, size), func(b *testing.B) {
+				buf := NewBuffer(execNothing, kind.opts...)
+				buf.ReadFromFile(grid.LineCol{}, "", bytesOfLines(size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i += 1 {
+					edit(buf, size, i)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	benchmarkBuffers(b, func(buf Buffer, size, i int) {
+		buf.Insert(grid.LineCol{Line: i % size, Col: 0}, 'x')
+	})
+}
+
+func BenchmarkReturnAndDelete(b *testing.B) {
+	benchmarkBuffers(b, func(buf Buffer, size, i int) {
+		where := grid.LineCol{Line: size / 2, Col: 1}
+		buf.Return(where)
+		buf.DeleteLine(where.LinePlus(1))
+	})
+}
+
+func BenchmarkMoveLines(b *testing.B) {
+	benchmarkBuffers(b, func(buf Buffer, size, i int) {
+		buf.MoveLines(grid.LineCol{Line: size - 1}, 10, 20)
+	})
+}
@@ -0,0 +1,79 @@
+package text
+
+import (
+	"regexp"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/bounds"
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+// A Search looks for matches of a regular expression in the lines
+// of a buffer. Literal searches use a quoted pattern.
+type Search struct {
+	Pattern  *regexp.Regexp
+	Backward bool // look towards the start of the buffer
+	Wrap     bool // continue from the other end of the lines searched
+}
+
+// Find returns the start of the first match after from (or, searching
+// backward, the last match before it) in lines [low, high) of b, and
+// whether the search had to wrap around to find it. If from is not
+// within those lines the search starts at the end they are entered
+// from.
+func (s *Search) Find(b Buffer, from grid.LineCol, low, high int) (where grid.LineCol, wrapped, found bool) {
+	high = bounds.Min(high, b.LineCount())
+	n := high - low
+	if n <= 0 {
+		return from, false, false
+	}
+	if from.Line < low || from.Line >= high {
+		if s.Backward {
+			from = grid.LineCol{Line: high - 1, Col: RuneCount(b.Line(high-1)) + 1}
+		} else {
+			from = grid.LineCol{Line: low, Col: -1}
+		}
+	}
+	step := 1
+	if s.Backward {
+		step = n - 1
+	}
+	for i := 0; i <= n; i += 1 {
+		line := low + (from.Line-low+i*step)%n
+		if i > 0 && (s.Backward && line > from.Line || !s.Backward && line < from.Line || i == n) {
+			if !s.Wrap {
+				break
+			}
+			wrapped = true
+		}
+		col, ok := s.findInLine(b.Line(line), from.Col, i == 0, i == n)
+		if ok {
+			return grid.LineCol{Line: line, Col: col}, wrapped, true
+		}
+	}
+	return from, wrapped, false
+}
+
+// findInLine finds a match in line. On the starting line (first) the
+// match must be beyond col in the search direction; on returning to
+// the starting line after wrapping (last) it must not be.
+func (s *Search) findInLine(line string, col int, first, last bool) (int, bool) {
+	matches := s.Pattern.FindAllStringIndex(line, -1)
+	if s.Backward {
+		for i := len(matches) - 1; i >= 0; i -= 1 {
+			c := RuneCount(line[:matches[i][0]])
+			if first && c >= col || last && c < col {
+				continue
+			}
+			return c, true
+		}
+	} else {
+		for _, m := range matches {
+			c := RuneCount(line[:m[0]])
+			if first && c <= col || last && c > col {
+				continue
+			}
+			return c, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,35 @@
+package text
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/ehedgehog/guineapig/examples/termboxed/grid"
+)
+
+func TestFind(t *testing.T) {
+	b := NewBuffer(execNothing)
+	load(t, b, "a foo\nbar\n“foo” foo\nbaz\n")
+	s := &Search{Pattern: regexp.MustCompile("foo"), Wrap: true}
+	find := func(what string, from grid.LineCol, low, high int, where grid.LineCol, wrapped bool) {
+		t.Helper()
+		got, w, found := s.Find(b, from, low, high)
+		eq(t, what+": found", found, true)
+		eq(t, what+": where", got, where)
+		eq(t, what+": wrapped", w, wrapped)
+	}
+	find("forward", grid.LineCol{Line: 0, Col: 2}, 0, 4, grid.LineCol{Line: 2, Col: 1}, false)
+	find("forward in line", grid.LineCol{Line: 2, Col: 1}, 0, 4, grid.LineCol{Line: 2, Col: 6}, false)
+	find("forward wraps", grid.LineCol{Line: 2, Col: 6}, 0, 4, grid.LineCol{Line: 0, Col: 2}, true)
+	find("within range", grid.LineCol{Line: 2, Col: 6}, 1, 3, grid.LineCol{Line: 2, Col: 1}, true)
+	find("from outside range", grid.LineCol{Line: 0, Col: 0}, 1, 3, grid.LineCol{Line: 2, Col: 1}, false)
+
+	s.Backward = true
+	find("backward", grid.LineCol{Line: 2, Col: 1}, 0, 4, grid.LineCol{Line: 0, Col: 2}, false)
+	find("backward in line", grid.LineCol{Line: 2, Col: 6}, 0, 4, grid.LineCol{Line: 2, Col: 1}, false)
+	find("backward wraps", grid.LineCol{Line: 0, Col: 2}, 0, 4, grid.LineCol{Line: 2, Col: 6}, true)
+
+	s.Wrap = false
+	_, _, found := s.Find(b, grid.LineCol{Line: 0, Col: 2}, 0, 4)
+	eq(t, "no wrap", found, false)
+}
@@ -0,0 +1,92 @@
+package text
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// A Stamp identifies the content of a file as it was when a buffer
+// last matched it, so that changes made to the file by other programs
+// can be noticed.
+type Stamp struct {
+	ModTime time.Time
+	Size    int64
+	Sum     [sha256.Size]byte
+}
+
+// IsZero reports whether s is the stamp of no file.
+func (s Stamp) IsZero() bool {
+	return s == Stamp{}
+}
+
+// sameFile reports whether s and t have the same modification time
+// and size, in which case the file is taken not to have changed.
+func (s Stamp) sameFile(t Stamp) bool {
+	return s.ModTime.Equal(t.ModTime) && s.Size == t.Size
+}
+
+// stampOf returns the stamp of the named file given the hash of its
+// content.
+func stampOf(fileName string, sum []byte) (Stamp, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return Stamp{}, err
+	}
+	s := Stamp{ModTime: info.ModTime(), Size: info.Size()}
+	copy(s.Sum[:], sum)
+	return s, nil
+}
+
+// readStamp returns the stamp of the named file, just read with hash
+// h, or the zero Stamp if there is no such file.
+func readStamp(fileName string, h hash.Hash) Stamp {
+	if fileName == "" {
+		return Stamp{}
+	}
+	s, _ := stampOf(fileName, h.Sum(nil))
+	return s
+}
+
+// StampFile returns the stamp of the named file as it is now. The file
+// is read to hash it only if its modification time or size differ from
+// those of old.
+func StampFile(fileName string, old Stamp) (Stamp, error) {
+	s, err := stampOf(fileName, nil)
+	if err != nil || s.sameFile(old) {
+		s.Sum = old.Sum
+		return s, err
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Stamp{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return Stamp{}, err
+	}
+	copy(s.Sum[:], h.Sum(nil))
+	return s, nil
+}
+
+// ChangedOnDisk reports whether the file that b was read from or last
+// written to has since been changed by something else, returning the
+// file's stamp as it is now. A file that has gone away has not changed,
+// since writing it loses nothing.
+func ChangedOnDisk(b Buffer) (Stamp, bool, error) {
+	old := b.FileStamp()
+	if old.IsZero() || b.FileName() == "" {
+		return old, false, nil
+	}
+	now, err := StampFile(b.FileName(), old)
+	if os.IsNotExist(err) {
+		return old, false, nil
+	}
+	if err != nil {
+		return old, false, err
+	}
+	return now, now.Sum != old.Sum, nil
+}
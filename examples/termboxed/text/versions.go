@@ -0,0 +1,45 @@
+package text
+
+// versions counts the changes made to a buffer, so that the buffer
+// can tell whether it differs from the file it was read from or last
+// written to.
+type versions struct {
+	generation int   // the number of changes made so far
+	saved      int   // the generation that matches the file
+	stamp      Stamp // the file as it was then, if known
+}
+
+// changed notes that the buffer has changed.
+func (v *versions) changed() {
+	v.generation += 1
+}
+
+// markSaved notes that the buffer now matches its file, which has
+// the given stamp.
+func (v *versions) markSaved(stamp Stamp) {
+	v.saved = v.generation
+	v.stamp = stamp
+}
+
+// matchSaved notes that the buffer matches its file again, as it did
+// when it was last saved.
+func (v *versions) matchSaved() {
+	v.saved = v.generation
+}
+
+// Generation returns a number that changes whenever the buffer does.
+func (v *versions) Generation() int {
+	return v.generation
+}
+
+// FileStamp returns the stamp of the file as it was when the buffer
+// last matched it, or the zero Stamp if that is not known.
+func (v *versions) FileStamp() Stamp {
+	return v.stamp
+}
+
+// Modified reports whether the buffer has changed since it last
+// matched its file.
+func (v *versions) Modified() bool {
+	return v.generation != v.saved
+}